@@ -0,0 +1,11 @@
+CREATE TABLE survey.audit (
+  audit_pk SERIAL PRIMARY KEY,
+  survey_id uuid NOT NULL,
+  actor character varying(100) NOT NULL,
+  operation character varying(50) NOT NULL,
+  occurred_at timestamp with time zone NOT NULL DEFAULT now(),
+  before_state jsonb,
+  after_state jsonb
+);
+
+CREATE INDEX audit_survey_id_idx ON survey.audit (survey_id, audit_pk);
@@ -0,0 +1 @@
+ALTER TABLE survey.survey ADD COLUMN archived_at timestamp with time zone DEFAULT NULL;
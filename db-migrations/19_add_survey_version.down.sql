@@ -0,0 +1 @@
+ALTER TABLE survey.survey DROP COLUMN IF EXISTS version;
@@ -0,0 +1 @@
+ALTER TABLE survey.survey ADD COLUMN version integer NOT NULL DEFAULT 1;
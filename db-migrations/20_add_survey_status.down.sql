@@ -0,0 +1,2 @@
+ALTER TABLE survey.survey DROP COLUMN IF EXISTS status;
+DROP TYPE IF EXISTS survey.surveystatus;
@@ -0,0 +1,10 @@
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'surveystatus') THEN
+        create type survey.surveystatus AS ENUM ('DESIGN', 'LIVE', 'SUSPENDED', 'RETIRED');
+    END IF;
+END
+$$;
+-- Existing surveys are already in use, new ones start out in design
+ALTER TABLE survey.survey ADD COLUMN IF NOT EXISTS status survey.surveystatus NOT NULL DEFAULT 'LIVE';
+ALTER TABLE survey.survey ALTER COLUMN status SET DEFAULT 'DESIGN';
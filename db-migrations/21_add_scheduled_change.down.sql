@@ -0,0 +1 @@
+DROP TABLE IF EXISTS survey.scheduled_change;
@@ -0,0 +1,15 @@
+CREATE TABLE survey.scheduled_change (
+  scheduled_change_pk SERIAL PRIMARY KEY,
+  id uuid NOT NULL UNIQUE,
+  survey_id uuid NOT NULL REFERENCES survey.survey (id) ON DELETE CASCADE,
+  changes jsonb NOT NULL,
+  effective_from timestamp with time zone NOT NULL,
+  created_by character varying(100) NOT NULL,
+  created_at timestamp with time zone NOT NULL DEFAULT now(),
+  state character varying(20) NOT NULL DEFAULT 'PENDING',
+  processed_at timestamp with time zone,
+  failure_reason text
+);
+
+CREATE INDEX scheduled_change_survey_id_idx ON survey.scheduled_change (survey_id, effective_from);
+CREATE INDEX scheduled_change_due_idx ON survey.scheduled_change (effective_from) WHERE state = 'PENDING';
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS survey_history ON survey.survey;
+DROP TRIGGER IF EXISTS classifiertypeselector_history ON survey.classifiertypeselector;
+DROP TRIGGER IF EXISTS classifiertype_history ON survey.classifiertype;
+DROP FUNCTION IF EXISTS survey.record_history();
+DROP TABLE IF EXISTS survey.survey_history;
+DROP TABLE IF EXISTS survey.classifiertypeselector_history;
+DROP TABLE IF EXISTS survey.classifiertype_history;
@@ -0,0 +1,56 @@
+-- Each history table holds every version of a row along with the period it was current for. valid_to is NULL for
+-- the current version. The history columns come first so the rows of the original table can be copied with NEW.*,
+-- which means any column added to the original table must be added to the end of its history table as well.
+CREATE TABLE survey.survey_history (
+  valid_from timestamp with time zone NOT NULL,
+  valid_to timestamp with time zone,
+  LIKE survey.survey
+);
+
+CREATE TABLE survey.classifiertypeselector_history (
+  valid_from timestamp with time zone NOT NULL,
+  valid_to timestamp with time zone,
+  LIKE survey.classifiertypeselector
+);
+
+CREATE TABLE survey.classifiertype_history (
+  valid_from timestamp with time zone NOT NULL,
+  valid_to timestamp with time zone,
+  LIKE survey.classifiertype
+);
+
+CREATE INDEX survey_history_id_idx ON survey.survey_history (id, valid_from);
+CREATE INDEX survey_history_survey_ref_idx ON survey.survey_history (LOWER(survey_ref), valid_from);
+CREATE INDEX classifiertypeselector_history_id_idx ON survey.classifiertypeselector_history (id, valid_from);
+CREATE INDEX classifiertype_history_selector_idx ON survey.classifiertype_history (classifier_type_selector_fk, valid_from);
+
+-- Closes the current version of the changed row and opens a new one. The primary key column of the table is given as
+-- the trigger's argument. A version which was replaced in the same transaction it was created in is never visible,
+-- so it's removed rather than being kept with an empty period.
+CREATE OR REPLACE FUNCTION survey.record_history() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        EXECUTE format('UPDATE %I.%I SET valid_to = now() WHERE %I = ($1).%I AND valid_to IS NULL',
+                       TG_TABLE_SCHEMA, TG_TABLE_NAME || '_history', TG_ARGV[0], TG_ARGV[0]) USING OLD;
+        EXECUTE format('DELETE FROM %I.%I WHERE %I = ($1).%I AND valid_to = valid_from',
+                       TG_TABLE_SCHEMA, TG_TABLE_NAME || '_history', TG_ARGV[0], TG_ARGV[0]) USING OLD;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        EXECUTE format('INSERT INTO %I.%I SELECT now(), NULL, ($1).*',
+                       TG_TABLE_SCHEMA, TG_TABLE_NAME || '_history') USING NEW;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER survey_history AFTER INSERT OR UPDATE OR DELETE ON survey.survey
+    FOR EACH ROW EXECUTE PROCEDURE survey.record_history('survey_pk');
+CREATE TRIGGER classifiertypeselector_history AFTER INSERT OR UPDATE OR DELETE ON survey.classifiertypeselector
+    FOR EACH ROW EXECUTE PROCEDURE survey.record_history('classifier_type_selector_pk');
+CREATE TRIGGER classifiertype_history AFTER INSERT OR UPDATE OR DELETE ON survey.classifiertype
+    FOR EACH ROW EXECUTE PROCEDURE survey.record_history('classifier_type_pk');
+
+-- History is only known from now on
+INSERT INTO survey.survey_history SELECT now(), NULL, * FROM survey.survey;
+INSERT INTO survey.classifiertypeselector_history SELECT now(), NULL, * FROM survey.classifiertypeselector;
+INSERT INTO survey.classifiertype_history SELECT now(), NULL, * FROM survey.classifiertype;
@@ -0,0 +1,13 @@
+CREATE TABLE survey.idempotency_key (
+  actor character varying(100) NOT NULL,
+  idempotency_key character varying(255) NOT NULL,
+  request_hash character(64) NOT NULL,
+  status_code integer,
+  response_headers jsonb,
+  response_body bytea,
+  created_at timestamp with time zone NOT NULL DEFAULT now(),
+  expires_at timestamp with time zone NOT NULL,
+  PRIMARY KEY (actor, idempotency_key)
+);
+
+CREATE INDEX idempotency_key_expires_at_idx ON survey.idempotency_key (expires_at);
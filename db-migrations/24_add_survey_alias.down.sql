@@ -0,0 +1 @@
+DROP TABLE IF EXISTS survey.survey_alias;
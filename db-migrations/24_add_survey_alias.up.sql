@@ -0,0 +1,11 @@
+CREATE TABLE survey.survey_alias (
+  survey_alias_pk SERIAL PRIMARY KEY,
+  survey_id uuid NOT NULL REFERENCES survey.survey (id) ON DELETE CASCADE,
+  kind character varying(20) NOT NULL CHECK (kind IN ('SHORT_NAME', 'REF')),
+  alias character varying(100) NOT NULL,
+  created_by character varying(100) NOT NULL,
+  created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX survey_alias_kind_alias_idx ON survey.survey_alias (kind, LOWER(alias));
+CREATE INDEX survey_alias_survey_id_idx ON survey.survey_alias (survey_id);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS survey.delete_confirmation;
@@ -0,0 +1,10 @@
+CREATE TABLE survey.delete_confirmation (
+  token uuid PRIMARY KEY,
+  survey_id uuid NOT NULL REFERENCES survey.survey (id) ON DELETE CASCADE,
+  version integer NOT NULL,
+  created_by character varying(100) NOT NULL,
+  created_at timestamp with time zone NOT NULL DEFAULT now(),
+  expires_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX delete_confirmation_expires_at_idx ON survey.delete_confirmation (expires_at);
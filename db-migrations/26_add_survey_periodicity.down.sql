@@ -0,0 +1,5 @@
+ALTER TABLE survey.survey_history DROP COLUMN IF EXISTS period_format;
+ALTER TABLE survey.survey_history DROP COLUMN IF EXISTS periodicity;
+
+ALTER TABLE survey.survey DROP COLUMN IF EXISTS period_format;
+ALTER TABLE survey.survey DROP COLUMN IF EXISTS periodicity;
@@ -0,0 +1,8 @@
+-- Surveys which existed before periodicity was recorded have none until it's set
+ALTER TABLE survey.survey ADD COLUMN periodicity character varying(20)
+    CHECK (periodicity IN ('WEEKLY', 'MONTHLY', 'QUARTERLY', 'ANNUAL', 'AD_HOC'));
+ALTER TABLE survey.survey ADD COLUMN period_format character varying(20)
+    CHECK (period_format IN ('YYYY', 'YYYYMM', 'YYYYQ', 'YYYYWW'));
+
+ALTER TABLE survey.survey_history ADD COLUMN periodicity character varying(20);
+ALTER TABLE survey.survey_history ADD COLUMN period_format character varying(20);
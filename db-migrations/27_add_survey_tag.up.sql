@@ -0,0 +1,10 @@
+CREATE TABLE survey.survey_tag (
+  survey_tag_pk SERIAL PRIMARY KEY,
+  survey_id uuid NOT NULL REFERENCES survey.survey (id) ON DELETE CASCADE,
+  tag character varying(50) NOT NULL,
+  created_by character varying(100) NOT NULL,
+  created_at timestamp with time zone NOT NULL DEFAULT now(),
+  UNIQUE (survey_id, tag)
+);
+
+CREATE INDEX survey_tag_tag_idx ON survey.survey_tag (tag);
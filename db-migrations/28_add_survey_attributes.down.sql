@@ -0,0 +1,5 @@
+ALTER TABLE survey.survey_history DROP COLUMN IF EXISTS attributes;
+
+ALTER TABLE survey.survey DROP COLUMN IF EXISTS attributes;
+
+DROP TABLE IF EXISTS survey.attribute_definition;
@@ -0,0 +1,16 @@
+CREATE TABLE survey.attribute_definition (
+  attribute_definition_pk SERIAL PRIMARY KEY,
+  survey_type survey.survey_type NOT NULL,
+  name character varying(50) NOT NULL,
+  json_type character varying(10) NOT NULL CHECK (json_type IN ('string', 'number', 'integer', 'boolean')),
+  required boolean NOT NULL DEFAULT false,
+  allowed_values jsonb,
+  created_by character varying(100) NOT NULL,
+  created_at timestamp with time zone NOT NULL DEFAULT now(),
+  UNIQUE (survey_type, name)
+);
+
+-- Surveys hold the values of the attributes defined for their survey type
+ALTER TABLE survey.survey ADD COLUMN attributes jsonb NOT NULL DEFAULT '{}';
+
+ALTER TABLE survey.survey_history ADD COLUMN attributes jsonb;
@@ -0,0 +1,13 @@
+CREATE TABLE survey.survey_owner (
+  survey_id uuid PRIMARY KEY REFERENCES survey.survey (id) ON DELETE CASCADE,
+  division character varying(100) NOT NULL,
+  team_mailbox character varying(254) NOT NULL,
+  helpline character varying(20),
+  escalation_contacts jsonb NOT NULL DEFAULT '[]',
+  updated_by character varying(100) NOT NULL,
+  updated_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+-- Surveys are looked up by the division or mailbox which owns them
+CREATE INDEX survey_owner_division_idx ON survey.survey_owner (LOWER(division));
+CREATE INDEX survey_owner_team_mailbox_idx ON survey.survey_owner (LOWER(team_mailbox));
@@ -0,0 +1,9 @@
+CREATE TABLE survey.survey_translation (
+  survey_id uuid NOT NULL REFERENCES survey.survey (id) ON DELETE CASCADE,
+  locale character varying(10) NOT NULL,
+  field character varying(50) NOT NULL CHECK (field IN ('long_name', 'legal_basis')),
+  value character varying(400) NOT NULL,
+  updated_by character varying(100) NOT NULL,
+  updated_at timestamp with time zone NOT NULL DEFAULT now(),
+  PRIMARY KEY (survey_id, locale, field)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE survey.survey_external_id (
+  survey_id uuid NOT NULL REFERENCES survey.survey (id) ON DELETE CASCADE,
+  system character varying(20) NOT NULL,
+  identifier character varying(100) NOT NULL,
+  updated_by character varying(100) NOT NULL,
+  updated_at timestamp with time zone NOT NULL DEFAULT now(),
+  PRIMARY KEY (survey_id, system),
+  -- Each identifier in a system maps to one survey, which is how surveys are resolved
+  CONSTRAINT survey_external_id_system_identifier_key UNIQUE (system, identifier)
+);
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// The operations recorded in the audit table
+const (
+	auditCreateSurvey     = "CREATE_SURVEY"
+	auditUpdateSurvey     = "UPDATE_SURVEY"
+	auditPatchSurvey      = "PATCH_SURVEY"
+	auditReplaceSurvey    = "REPLACE_SURVEY"
+	auditDeleteSurvey     = "DELETE_SURVEY"
+	auditArchiveSurvey    = "ARCHIVE_SURVEY"
+	auditRestoreSurvey    = "RESTORE_SURVEY"
+	auditRenameSurvey     = "RENAME_SURVEY"
+	auditMergeSurvey      = "MERGE_SURVEY"
+	auditAddTag           = "ADD_TAG"
+	auditRemoveTag        = "REMOVE_TAG"
+	auditSetOwner         = "SET_OWNER"
+	auditRemoveOwner      = "REMOVE_OWNER"
+	auditTranslateSurvey  = "TRANSLATE_SURVEY"
+	auditSetExternalID    = "SET_EXTERNAL_ID"
+	auditRemoveExternalID = "REMOVE_EXTERNAL_ID"
+	auditChangeStatus     = "CHANGE_STATUS"
+	auditScheduledChange  = "SCHEDULED_CHANGE"
+	auditCreateClassifier = "CREATE_CLASSIFIER"
+)
+
+// AuditEntry represents a change made to a survey, who made it and when
+type AuditEntry struct {
+	Actor     string          `json:"actor"`
+	Timestamp time.Time       `json:"timestamp"`
+	Operation string          `json:"operation"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+}
+
+// requestActor returns the user name the request was authenticated with
+func requestActor(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return user
+	}
+	return "unknown"
+}
+
+// auditState marshals the state of a survey or classifier for the audit table, where nil is stored as NULL
+func auditState(state interface{}) (sql.NullString, error) {
+	if state == nil {
+		return sql.NullString{}, nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// writeAudit records an operation on a survey and its state before and after using transaction tx, so the audit
+// record is only kept if the change is
+func (api *API) writeAudit(tx *sql.Tx, actor, surveyID, operation string, before, after interface{}) error {
+	beforeState, err := auditState(before)
+	if err != nil {
+		return err
+	}
+
+	afterState, err := auditState(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(api.CreateAuditStmt).Exec(surveyID, actor, operation, beforeState, afterState)
+	return err
+}
+
+// getSurveySnapshot returns the survey with the given UUID string along with its classifiers using transaction tx.
+// Archived surveys are included.
+func (api *API) getSurveySnapshot(tx *sql.Tx, surveyID string) (*Survey, error) {
+	survey := new(Survey)
+	err := tx.Stmt(api.GetSurveyIncludingArchivedStmt).QueryRow(surveyID).Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis, &survey.ArchivedAt, &survey.Version, &survey.Status, &survey.Periodicity, &survey.PeriodFormat, &survey.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	survey.Classifiers, err = api.getSurveyClassifiers(tx, surveyID)
+	return survey, err
+}
+
+// getSurveyClassifiers returns the classifier type selectors of a survey with their classifier types
+func (api *API) getSurveyClassifiers(tx *sql.Tx, surveyID string) ([]ClassifierTypeSelector, error) {
+	rows, err := tx.Stmt(api.GetSurveyClassifiersStmt).Query(surveyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var classifiers []ClassifierTypeSelector
+	for rows.Next() {
+		var id, name string
+		var classifierType sql.NullString
+		if err := rows.Scan(&id, &name, &classifierType); err != nil {
+			return nil, err
+		}
+
+		if len(classifiers) == 0 || classifiers[len(classifiers)-1].ID != id {
+			classifiers = append(classifiers, ClassifierTypeSelector{ID: id, Name: name, ClassifierTypes: []string{}})
+		}
+		if classifierType.Valid {
+			last := &classifiers[len(classifiers)-1]
+			last.ClassifierTypes = append(last.ClassifierTypes, classifierType.String)
+		}
+	}
+	return classifiers, rows.Err()
+}
+
+// GetSurveyHistory returns the audit trail of the survey identified by surveyId, oldest change first. The history
+// of a deleted survey is kept.
+func (api *API) GetSurveyHistory(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Getting SurveyHistory", zap.String("url", r.URL.Path))
+	vars := mux.Vars(r)
+	surveyID := vars["surveyId"]
+
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ["+surveyID+"] is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := api.GetSurveyHistoryStmt.Query(surveyID)
+	if err != nil {
+		logErrorAndRespond(w, "Get survey history query failed", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	entries := make([]*AuditEntry, 0)
+	for rows.Next() {
+		entry := new(AuditEntry)
+		var before, after sql.NullString
+		if err := rows.Scan(&entry.Actor, &entry.Timestamp, &entry.Operation, &before, &after); err != nil {
+			logErrorAndRespond(w, "Failed to get survey history from database", http.StatusInternalServerError, err)
+			return
+		}
+
+		if before.Valid {
+			entry.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			entry.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		http.Error(w, "No history found", http.StatusNoContent)
+		return
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		logErrorAndRespond(w, "Failed to marshal survey history JSON", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
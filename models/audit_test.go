@@ -0,0 +1,130 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSurveyHistoryReturnsJSON(t *testing.T) {
+	Convey("Survey history returns the audit trail of a survey", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		occurred := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+		historyRows := sqlmock.NewRows([]string{"actor", "occurred_at", "operation", "before_state", "after_state"}).
+			AddRow("admin", occurred, "CREATE_SURVEY", nil, `{"surveyMode":"SEFT"}`).
+			AddRow("admin", occurred.Add(time.Hour), "PATCH_SURVEY", `{"surveyMode":"SEFT"}`, `{"surveyMode":"EQ"}`)
+		mock.ExpectPrepare("SELECT actor, occurred_at, operation, before_state, after_state FROM survey.audit WHERE survey_id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(historyRows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/history"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := []models.AuditEntry{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res, ShouldHaveLength, 2)
+		So(res[0].Operation, ShouldEqual, "CREATE_SURVEY")
+		So(string(res[0].Before), ShouldEqual, "null")
+		So(res[1].Actor, ShouldEqual, "admin")
+		So(string(res[1].After), ShouldEqual, `{"surveyMode":"EQ"}`)
+	})
+}
+
+func TestSurveyHistoryNoContent(t *testing.T) {
+	Convey("Survey history returns a 204 when a survey has no history", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		historyRows := sqlmock.NewRows([]string{"actor", "occurred_at", "operation", "before_state", "after_state"})
+		mock.ExpectPrepare("SELECT actor, occurred_at, operation, before_state, after_state FROM survey.audit WHERE survey_id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(historyRows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/history"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+	})
+}
+
+func TestSurveyHistoryInvalidUUID(t *testing.T) {
+	Convey("Survey history returns a 400 for an invalid survey id", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/not-a-valid-uuid/history"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// errPreconditionFailed is returned when a write's If-Match header doesn't match the current version of the survey
+var errPreconditionFailed = errors.New("The survey has been changed since it was last retrieved")
+
+// A localised entity tag is the version followed by the language the survey was shown in, e.g. "3-cy"
+var localisedETagPattern = regexp.MustCompile(`"([0-9]+)-[a-z]+"`)
+
+// surveyETag returns the entity tag of a survey at the given version. Classifiers are versioned along with the
+// survey they belong to, so their representations share the survey's entity tag.
+func surveyETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// localisedSurveyETag returns the entity tag of a survey at the given version shown in the given language, as chosen
+// by localiseSurveys. Surveys shown in English have the same entity tag as the survey itself.
+func localisedSurveyETag(version int, locale string) string {
+	if locale == "" || locale == defaultLocale {
+		return surveyETag(version)
+	}
+	return strconv.Quote(strconv.Itoa(version) + "-" + locale)
+}
+
+// etagMatches reports whether any of the entity tags listed in an If-Match or If-None-Match header match etag.
+// Weak entity tags only match when weak is true, as If-Match requires a strong comparison.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified sets etag as the ETag header of the survey representation about to be written. If the request's
+// If-None-Match header matches it a 304 Not Modified is sent instead and true is returned.
+func writeNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	if header := r.Header.Get("If-None-Match"); header != "" && etagMatches(header, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// checkIfMatch checks ifMatch, the value of a request's If-Match header, against the current version of the
+// survey. The survey is locked for the rest of transaction tx so it can't change before the write is committed.
+// Requests without an If-Match header always pass. The language of a localised entity tag is ignored, as the survey
+// is the same whichever language it was read in.
+func (api *API) checkIfMatch(tx *sql.Tx, surveyID, ifMatch string) error {
+	if ifMatch == "" {
+		return nil
+	}
+
+	var version int
+	err := tx.Stmt(api.LockSurveyVersionStmt).QueryRow(surveyID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return errPreconditionFailed
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "Error locking survey")
+	}
+
+	return matchIfMatch(ifMatch, version)
+}
+
+// matchIfMatch checks ifMatch, the value of a request's If-Match header, against version, the version of a survey
+// the caller has already locked
+func matchIfMatch(ifMatch string, version int) error {
+	if ifMatch != "" && !etagMatches(localisedETagPattern.ReplaceAllString(ifMatch, `"$1"`), surveyETag(version), false) {
+		return errPreconditionFailed
+	}
+	return nil
+}
+
+// bumpSurveyVersion increments the version of the survey using transaction tx and returns the new version
+func (api *API) bumpSurveyVersion(tx *sql.Tx, surveyID string) (int, error) {
+	var version int
+	err := tx.Stmt(api.BumpSurveyVersionStmt).QueryRow(surveyID).Scan(&version)
+	return version, err
+}
+
+// writePreconditionError responds to a request whose If-Match header couldn't be checked
+func writePreconditionError(w http.ResponseWriter, err error) {
+	if err == errPreconditionFailed {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	logErrorAndRespond(w, "Error checking survey version", http.StatusInternalServerError, err)
+}
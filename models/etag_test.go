@@ -0,0 +1,178 @@
+package models_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSurveyGetReturnsETag(t *testing.T) {
+	Convey("Survey GET returns the survey's version as an ETag", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, 3, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectQuery("SELECT id, s.short_name, .+, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s .+ WHERE id = .+").WithArgs(surveyID).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"3"`)
+	})
+}
+
+func TestSurveyGetNotModified(t *testing.T) {
+	Convey("Survey GET returns a 304 if the survey matches If-None-Match", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, 3, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectQuery("SELECT id, s.short_name, .+, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s .+ WHERE id = .+").WithArgs(surveyID).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("If-None-Match", `"2", W/"3"`)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusNotModified)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"3"`)
+	})
+}
+
+func TestPutSurveyDetailsBySurveyRefPreconditionFailed(t *testing.T) {
+	Convey("Survey Details PUT by Survey Reference returns a 412 if If-Match is stale", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		surveyRow := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, "456", "STA1947", surveyType, surveyMode, legalBasisLongName, 3, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectQuery("SELECT id, s.short_name, .+, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s .+ WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs("456").WillReturnRows(surveyRow)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ARRAY\\(SELECT .+\\) .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, "456", "STA1947", surveyType, surveyMode, legalBasisLongName, 3, "LIVE", nil, nil, nil, nil, nil))
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/ref/456"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		var jsonStr = []byte(`{"ShortName": "test-short-name", "LongName":"test-long-name", "surveyMode":"SEFT"}`)
+		r, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonStr))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("If-Match", `"2"`)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusPreconditionFailed)
+	})
+}
+
+func TestPatchSurveyMatchingIfMatch(t *testing.T) {
+	Convey("Survey PATCH with a current If-Match updates the survey and returns the new ETag", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, "Statistics of Trade Act 1947", 3, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", "Statistics of Trade Act 1947"))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}).AddRow(reference))
+		mock.ExpectPrepare("UPDATE survey.survey SET survey_ref = .+ WHERE id = .+").ExpectExec().WithArgs(surveyID, reference, shortName, longName, "STA1947", surveyType, "EQ", nil, nil, "{}").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "PATCH_SURVEY", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("PATCH", url, bytes.NewBufferString(`{"surveyMode":"EQ"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/merge-patch+json")
+		r.Header.Set("If-Match", `"3"`)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"4"`)
+	})
+}
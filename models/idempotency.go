@@ -0,0 +1,157 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	defaultIdempotencyKeyTTL = 24 * time.Hour
+)
+
+// responseRecorder passes a response through to the client while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(data)
+	return rec.ResponseWriter.Write(data)
+}
+
+// requestHash returns a hash identifying the method, path, query string and body of a request
+func requestHash(r *http.Request, body []byte) string {
+	target := r.URL.Path
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+target+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// idempotent is middleware which honours an Idempotency-Key header. The response to the first request with a key is
+// stored for IdempotencyKeyTTL and replayed for any retry with the same key and body, so a client can safely retry a
+// request it doesn't know the outcome of. Keys are scoped to the authenticated user. Server errors aren't stored, so
+// the request can be retried for real.
+func (api *API) idempotent(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			h(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, idempotencyKeyHeader+" must be at most "+strconv.Itoa(maxIdempotencyKeyLength)+" characters", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logErrorAndRespond(w, "Error reading request body", http.StatusInternalServerError, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		actor := requestActor(r)
+		hash := requestHash(r, body)
+		result, err := api.ClaimIdempotencyKeyStmt.Exec(actor, key, hash, int(api.IdempotencyKeyTTL.Seconds()))
+		if err != nil {
+			logErrorAndRespond(w, "Error claiming idempotency key", http.StatusInternalServerError, err)
+			return
+		}
+
+		if claimed, err := result.RowsAffected(); err != nil {
+			logErrorAndRespond(w, "Error claiming idempotency key", http.StatusInternalServerError, err)
+			return
+		} else if claimed == 0 {
+			api.replayResponse(w, actor, key, hash)
+			return
+		}
+
+		if _, err := api.DeleteExpiredIdempotencyKeysStmt.Exec(); err != nil {
+			logError("Error deleting expired idempotency keys", err)
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		h(rec, r)
+
+		if rec.status >= http.StatusInternalServerError {
+			if _, err := api.ReleaseIdempotencyKeyStmt.Exec(actor, key); err != nil {
+				logError("Error releasing idempotency key", err)
+			}
+			return
+		}
+
+		headers, err := json.Marshal(rec.Header())
+		if err == nil {
+			_, err = api.SaveIdempotentResponseStmt.Exec(actor, key, rec.status, string(headers), rec.body.Bytes())
+		}
+		if err != nil {
+			logError("Error saving idempotent response", err)
+		}
+	}
+}
+
+// replayResponse writes the stored response for the key, provided it was sent with the same request
+func (api *API) replayResponse(w http.ResponseWriter, actor, key, hash string) {
+	var storedHash string
+	var status sql.NullInt64
+	var headers, body []byte
+	err := api.GetIdempotencyKeyStmt.QueryRow(actor, key).Scan(&storedHash, &status, &headers, &body)
+	if err != nil {
+		logErrorAndRespond(w, "Error getting idempotency key", http.StatusInternalServerError, err)
+		return
+	}
+
+	if storedHash != hash {
+		http.Error(w, idempotencyKeyHeader+" has already been used for a different request", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if !status.Valid {
+		http.Error(w, "A request with this "+idempotencyKeyHeader+" is still being processed", http.StatusConflict)
+		return
+	}
+
+	var header http.Header
+	if err := json.Unmarshal(headers, &header); err != nil {
+		logErrorAndRespond(w, "Error reading stored response headers", http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("Replaying idempotent response", zap.String("idempotencyKey", key))
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(int(status.Int64))
+	w.Write(body)
+}
@@ -0,0 +1,191 @@
+package models_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	idempotencyKey    = "9b2f6a0e-create-survey-99"
+	createSurveyJSON  = `{"ShortName": "test-short-name", "LongName":"test-long-name","SurveyRef":"99","LegalBasis":"Statistics of Trade Act 1947","SurveyType":"Social", "SurveyMode":"SEFT"}`
+	createSurveyReply = `{"id":"` + surveyID + `","shortName":"test-short-name"}`
+)
+
+func createSurveyHash(body string) string {
+	hash := sha256.Sum256([]byte("POST /surveys\n" + body))
+	return hex.EncodeToString(hash[:])
+}
+
+func importHash(mode, body string) string {
+	hash := sha256.Sum256([]byte("POST /surveys/import?mode=" + mode + "\n" + body))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestIdempotentCreateStoresResponse(t *testing.T) {
+	Convey("Survey POST with an Idempotency-Key stores the response for replay", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE long_name = .+").WithArgs("Statistics of Trade Act 1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", "Statistics of Trade Act 1947"))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs("test-short-name").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs("99").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		payload := `{"ShortName": "test-short-name", "LongName":"test-long-name","SurveyRef":"99","LegalBasis":"Statistics of Trade Act 1947","SurveyType":"Invalid", "SurveyMode":"SEFT"}`
+		mock.ExpectExec("INSERT INTO survey.idempotency_key .+").WithArgs("unknown", idempotencyKey, createSurveyHash(payload), 86400).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM survey.idempotency_key WHERE expires_at < now\\(\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("UPDATE survey.idempotency_key SET status_code = .+").WithArgs("unknown", idempotencyKey, http.StatusBadRequest, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Idempotency-Key", idempotencyKey)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		So(resp.Header.Get("Idempotent-Replayed"), ShouldBeEmpty)
+	})
+}
+
+func TestIdempotentCreateReplaysResponse(t *testing.T) {
+	Convey("Survey POST retried with the same Idempotency-Key and body replays the original response", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"request_hash", "status_code", "response_headers", "response_body"}).AddRow(createSurveyHash(createSurveyJSON), http.StatusCreated, []byte(`{"Content-Type":["application/json"],"Etag":["\"1\""]}`), []byte(createSurveyReply))
+		mock.ExpectExec("INSERT INTO survey.idempotency_key .+").WithArgs("unknown", idempotencyKey, createSurveyHash(createSurveyJSON), 86400).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT request_hash, status_code, response_headers, response_body FROM survey.idempotency_key .+").WithArgs("unknown", idempotencyKey).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(createSurveyJSON))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Idempotency-Key", idempotencyKey)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+		So(resp.Header.Get("Idempotent-Replayed"), ShouldEqual, "true")
+		So(resp.Header.Get("ETag"), ShouldEqual, `"1"`)
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, createSurveyReply)
+	})
+}
+
+func TestIdempotentCreateKeyReusedWithDifferentBody(t *testing.T) {
+	Convey("Survey POST returns a 422 if the Idempotency-Key was used for a different request", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"request_hash", "status_code", "response_headers", "response_body"}).AddRow(createSurveyHash(createSurveyJSON), http.StatusCreated, []byte(`{}`), []byte(createSurveyReply))
+		mock.ExpectExec("INSERT INTO survey.idempotency_key .+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT request_hash, status_code, response_headers, response_body FROM survey.idempotency_key .+").WithArgs("unknown", idempotencyKey).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(strings.Replace(createSurveyJSON, "SEFT", "EQ", 1)))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Idempotency-Key", idempotencyKey)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+	})
+}
+
+func TestIdempotentImportKeyReusedWithDifferentQuery(t *testing.T) {
+	Convey("Survey import returns a 422 if the Idempotency-Key was used for a request with a different query string", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"request_hash", "status_code", "response_headers", "response_body"}).AddRow(importHash("all-or-nothing", "["+createSurveyJSON+"]"), http.StatusCreated, []byte(`{}`), []byte(createSurveyReply))
+		mock.ExpectExec("INSERT INTO survey.idempotency_key .+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT request_hash, status_code, response_headers, response_body FROM survey.idempotency_key .+").WithArgs("unknown", idempotencyKey).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/import?mode=best-effort"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader("["+createSurveyJSON+"]"))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Idempotency-Key", idempotencyKey)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+	})
+}
@@ -0,0 +1,397 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// The states a scheduled change moves through
+const (
+	scheduledChangePending   = "PENDING"
+	scheduledChangeApplied   = "APPLIED"
+	scheduledChangeFailed    = "FAILED"
+	scheduledChangeCancelled = "CANCELLED"
+)
+
+// ScheduledChange represents a merge patch to apply to a survey once effectiveFrom has passed
+type ScheduledChange struct {
+	ID            string          `json:"id"`
+	SurveyID      string          `json:"surveyId"`
+	Changes       json.RawMessage `json:"changes"`
+	EffectiveFrom time.Time       `json:"effectiveFrom"`
+	State         string          `json:"state"`
+	CreatedBy     string          `json:"createdBy"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	ProcessedAt   *time.Time      `json:"processedAt,omitempty"`
+	FailureReason string          `json:"failureReason,omitempty"`
+}
+
+// scheduledChangeRequest is the body of a request to schedule a change
+type scheduledChangeRequest struct {
+	EffectiveFrom *time.Time             `json:"effectiveFrom"`
+	Changes       map[string]interface{} `json:"changes"`
+}
+
+// PostScheduledChange endpoint handler - schedules a change to the survey identified by surveyId. The change is a JSON
+// merge patch, as accepted by PATCH /surveys/{surveyId}, which is applied once its effectiveFrom time has passed.
+func (api *API) PostScheduledChange(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	surveyID := vars["surveyId"]
+	logger.Info("Scheduling survey change", zap.String("surveyID", surveyID))
+
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ["+surveyID+"] is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading scheduled change", http.StatusInternalServerError, err)
+		return
+	}
+
+	var request scheduledChangeRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
+	}
+
+	if request.EffectiveFrom == nil || !request.EffectiveFrom.After(time.Now()) {
+		http.Error(w, "effectiveFrom must be a time in the future", http.StatusBadRequest)
+		return
+	}
+
+	if len(request.Changes) == 0 {
+		http.Error(w, "changes must contain at least one field", http.StatusBadRequest)
+		return
+	}
+
+	if message := checkSurveyPatch(surveyID, request.Changes); message != "" {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	survey, err := api.getSurvey(surveyID)
+	if err == sql.ErrNoRows {
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		logErrorAndRespond(w, "Error retrieving survey by survey ID", http.StatusInternalServerError, err)
+		return
+	}
+
+	// Check the change against the survey as it is now so obvious mistakes are caught straight away. It's checked
+	// again when it's applied.
+	patched, err := applySurveyPatch(survey, request.Changes)
+	if err != nil {
+		http.Error(w, "Error applying patch - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, reqErr := api.firstSurveyProblem(patched, survey.Reference); reqErr != nil {
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		http.Error(w, "Error generating random uuid", http.StatusInternalServerError)
+		return
+	}
+
+	changes, err := json.Marshal(request.Changes)
+	if err != nil {
+		logErrorAndRespond(w, "Error marshalling scheduled change", http.StatusInternalServerError, err)
+		return
+	}
+
+	change := ScheduledChange{
+		ID:            id.String(),
+		SurveyID:      surveyID,
+		Changes:       changes,
+		EffectiveFrom: *request.EffectiveFrom,
+		CreatedBy:     requestActor(r),
+	}
+	err = api.CreateScheduledChangeStmt.QueryRow(change.ID, surveyID, string(changes), change.EffectiveFrom, change.CreatedBy).
+		Scan(&change.State, &change.CreatedAt)
+	if err != nil {
+		logErrorAndRespond(w, "Create scheduled change failed", http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("Successfully scheduled survey change", zap.String("surveyID", surveyID), zap.String("scheduledChangeID", change.ID))
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(change); err != nil {
+		logError("Error encoding response to 'post scheduled change'", err)
+	}
+}
+
+// AllScheduledChanges returns the pending changes to the survey identified by surveyId in the order they fall due.
+// Applied, failed and cancelled changes are included if includeProcessed is true.
+func (api *API) AllScheduledChanges(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Getting AllScheduledChanges", zap.String("url", r.URL.Path))
+	vars := mux.Vars(r)
+	surveyID := vars["surveyId"]
+
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ["+surveyID+"] is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	includeProcessed := false
+	if v := r.URL.Query().Get("includeProcessed"); v != "" {
+		var err error
+		if includeProcessed, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "includeProcessed must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err := api.getSurveyVersion(surveyID); err == sql.ErrNoRows {
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logErrorAndRespond(w, "Error retrieving survey by survey ID", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := api.GetScheduledChangesStmt.Query(surveyID, includeProcessed)
+	if err != nil {
+		logErrorAndRespond(w, "Get scheduled changes query failed", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	changes := make([]*ScheduledChange, 0)
+	for rows.Next() {
+		change := new(ScheduledChange)
+		var patch []byte
+		err := rows.Scan(&change.ID, &change.SurveyID, &patch, &change.EffectiveFrom, &change.State, &change.CreatedBy,
+			&change.CreatedAt, &change.ProcessedAt, &change.FailureReason)
+		if err != nil {
+			logErrorAndRespond(w, "Failed to get scheduled changes from database", http.StatusInternalServerError, err)
+			return
+		}
+		change.Changes = json.RawMessage(patch)
+		changes = append(changes, change)
+	}
+
+	if len(changes) == 0 {
+		http.Error(w, "No scheduled changes found", http.StatusNoContent)
+		return
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		logErrorAndRespond(w, "Failed to marshal scheduled changes JSON", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// CancelScheduledChange endpoint handler - cancels the pending change identified by scheduledChangeId
+func (api *API) CancelScheduledChange(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	surveyID := vars["surveyId"]
+	scheduledChangeID := vars["scheduledChangeId"]
+	logger.Info("Cancelling scheduled change", zap.String("surveyID", surveyID), zap.String("scheduledChangeID", scheduledChangeID))
+
+	for _, id := range []string{surveyID, scheduledChangeID} {
+		if _, err := uuid.FromString(id); err != nil {
+			http.Error(w, "The value ["+id+"] is not a valid UUID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := api.CancelScheduledChangeStmt.Exec(scheduledChangeID, surveyID)
+	if err != nil {
+		logErrorAndRespond(w, "Cancel scheduled change query failed", http.StatusInternalServerError, err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		logErrorAndRespond(w, "Error getting rows affected by cancelling scheduled change", http.StatusInternalServerError, err)
+		return
+	}
+
+	if rowsAffected == 0 {
+		writeRestErrorResponse(w, "Pending scheduled change not found", http.StatusNotFound)
+		return
+	}
+
+	logger.Info("Successfully cancelled scheduled change", zap.String("scheduledChangeID", scheduledChangeID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RunScheduledChanges applies scheduled changes as they fall due, checking every interval until ctx is done
+func (api *API) RunScheduledChanges(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if applied, err := api.ApplyDueScheduledChanges(); err != nil {
+			logError("Error applying scheduled changes", err)
+		} else if applied > 0 {
+			logger.Info("Applied scheduled changes", zap.Int("count", applied))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ApplyDueScheduledChanges applies every pending change whose effectiveFrom time has passed, oldest first, returning
+// the number processed. Each change is applied in its own transaction which also marks it as processed, and rows are
+// claimed with SKIP LOCKED, so several replicas can run this at once and a change is never applied twice.
+func (api *API) ApplyDueScheduledChanges() (int, error) {
+	processed := 0
+	for {
+		found, err := api.applyNextScheduledChange()
+		if err != nil || !found {
+			return processed, err
+		}
+		processed++
+	}
+}
+
+// scheduledChangeSavepoint is the savepoint a scheduled change which can't be applied is rolled back to
+const scheduledChangeSavepoint = "apply_scheduled_change"
+
+// applyNextScheduledChange applies the pending change which fell due first, returning false if there isn't one. A
+// change which can't be applied, for example because its short name has since been taken or applying it fails, is
+// marked as failed with the reason rather than returning an error.
+func (api *API) applyNextScheduledChange() (bool, error) {
+	tx, err := api.DB.Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "Error creating transaction")
+	}
+
+	var id, surveyID, actor string
+	var changes []byte
+	err = tx.Stmt(api.NextDueScheduledChangeStmt).QueryRow().Scan(&id, &surveyID, &changes, &actor)
+	if err == sql.ErrNoRows {
+		rollBack(tx)
+		return false, nil
+	}
+	if err != nil {
+		rollBack(tx)
+		return false, errors.Wrap(err, "Error getting next scheduled change")
+	}
+
+	// A change which fails part way through is rolled back to here, keeping the claim on it so it's marked as failed
+	// rather than being claimed again on every tick and holding up the changes behind it
+	if _, err := tx.Exec("SAVEPOINT " + scheduledChangeSavepoint); err != nil {
+		rollBack(tx)
+		return false, errors.Wrap(err, "Error creating savepoint")
+	}
+
+	failure, err := api.applyScheduledChange(tx, surveyID, changes, actor)
+	if err != nil {
+		if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT " + scheduledChangeSavepoint); rbErr != nil {
+			rollBack(tx)
+			return false, errors.Wrapf(rbErr, "Error rolling back scheduled change '%s'", id)
+		}
+		logError("Error applying scheduled change "+id, err)
+		failure = err.Error()
+	}
+
+	state := scheduledChangeApplied
+	if failure != "" {
+		state = scheduledChangeFailed
+		logger.Warn("Scheduled change could not be applied", zap.String("scheduledChangeID", id), zap.String("reason", failure))
+	}
+
+	if _, err := tx.Stmt(api.CompleteScheduledChangeStmt).Exec(id, state, failure); err != nil {
+		rollBack(tx)
+		return false, errors.Wrapf(err, "Error completing scheduled change '%s'", id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		return false, errors.Wrap(err, "Error committing transaction")
+	}
+
+	return true, nil
+}
+
+// applyScheduledChange applies the merge patch changes to the survey identified by surveyID using transaction tx,
+// recording it in the survey's history against actor. The reason the change can't be applied is returned if the
+// patched survey is no longer valid.
+func (api *API) applyScheduledChange(tx *sql.Tx, surveyID string, changes []byte, actor string) (string, error) {
+	// Lock the survey so the change can't interleave with a conditional write
+	var version int
+	if err := tx.Stmt(api.LockSurveyVersionStmt).QueryRow(surveyID).Scan(&version); err == sql.ErrNoRows {
+		return "The survey no longer exists", nil
+	} else if err != nil {
+		return "", errors.Wrap(err, "Error locking survey")
+	}
+
+	survey, err := api.getSurveySnapshot(tx, surveyID)
+	if err != nil {
+		return "", errors.Wrap(err, "Error retrieving survey")
+	}
+
+	if survey.ArchivedAt != nil {
+		return "The survey is archived", nil
+	}
+
+	var patch map[string]interface{}
+	if err := json.Unmarshal(changes, &patch); err != nil {
+		return "The changes are not valid JSON", nil
+	}
+
+	patched, err := applySurveyPatch(survey, patch)
+	if err != nil {
+		return "Error applying patch - " + err.Error(), nil
+	}
+
+	legalBasis, reqErr := api.firstSurveyProblem(patched, survey.Reference)
+	if reqErr != nil {
+		return reqErr.message, nil
+	}
+	patched.LegalBasisRef = legalBasis.Reference
+	patched.LegalBasis = legalBasis.LongName
+
+	if reqErr := api.recordRename(tx, surveyID, actor, survey, patched); reqErr != nil {
+		if reqErr.status == http.StatusInternalServerError {
+			return "", errors.New(reqErr.message)
+		}
+		return reqErr.message, nil
+	}
+
+	_, err = tx.Stmt(api.UpdateSurveyStmt).Exec(surveyID, patched.Reference, patched.ShortName, patched.LongName,
+		patched.LegalBasisRef, patched.SurveyType, patched.SurveyMode, patched.Periodicity, patched.PeriodFormat, patched.Attributes)
+	if err != nil {
+		return "", errors.Wrap(err, "Update survey query failed")
+	}
+
+	if _, err := api.bumpSurveyVersion(tx, surveyID); err != nil {
+		return "", errors.Wrap(err, "Failed to update survey version")
+	}
+
+	if err := api.writeAudit(tx, actor, surveyID, auditScheduledChange, survey, patched); err != nil {
+		return "", errors.Wrap(err, "Failed to audit scheduled change")
+	}
+
+	return "", nil
+}
@@ -0,0 +1,217 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const scheduledChangeID = "5e1a9c4e-3b1f-4c35-a3a3-2d8f1c0b6e7a"
+
+func TestPostScheduledChangeSuccess(t *testing.T) {
+	Convey("Scheduled change POST stores a change to apply later", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		effectiveFrom := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, "SEFT", legalBasisLongName, 1, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectQuery("SELECT id, s.short_name, .+ WHERE id = .+").WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}).AddRow(reference))
+		mock.ExpectQuery("INSERT INTO survey.scheduled_change .+").WithArgs(sqlmock.AnyArg(), surveyID, `{"surveyMode":"EQ"}`, effectiveFrom, "unknown").WillReturnRows(sqlmock.NewRows([]string{"state", "created_at"}).AddRow("PENDING", time.Now()))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/scheduledchanges"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"effectiveFrom": "` + effectiveFrom.Format(time.RFC3339) + `", "changes": {"surveyMode": "EQ"}}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+		res := models.ScheduledChange{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.ID, ShouldNotBeEmpty)
+		So(res.SurveyID, ShouldEqual, surveyID)
+		So(res.State, ShouldEqual, "PENDING")
+		So(res.EffectiveFrom.Equal(effectiveFrom), ShouldBeTrue)
+	})
+}
+
+func TestPostScheduledChangeInThePast(t *testing.T) {
+	Convey("Scheduled change POST returns a 400 if effectiveFrom has already passed", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/scheduledchanges"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(`{"effectiveFrom": "2020-01-01T00:00:00Z", "changes": {"surveyMode": "EQ"}}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, "effectiveFrom must be a time in the future")
+	})
+}
+
+func TestCancelScheduledChangeNotFound(t *testing.T) {
+	Convey("Scheduled change DELETE returns a 404 if there's no pending change with the id", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectExec("UPDATE survey.scheduled_change SET state = 'CANCELLED', .+").WithArgs(scheduledChangeID, surveyID).WillReturnResult(sqlmock.NewResult(0, 0))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/scheduledchanges/" + scheduledChangeID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("DELETE", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestApplyDueScheduledChanges(t *testing.T) {
+	Convey("Due scheduled changes are applied to the survey and marked as applied", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, "SEFT", legalBasisLongName, nil, 3, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT id, survey_id, changes, created_by FROM survey.scheduled_change .+").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"id", "survey_id", "changes", "created_by"}).AddRow(scheduledChangeID, surveyID, []byte(`{"surveyMode":"EQ"}`), "admin"))
+		mock.ExpectExec("SAVEPOINT apply_scheduled_change").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectPrepare("SELECT survey_type, name, json_type, required, allowed_values FROM survey.attribute_definition .+").ExpectQuery().WithArgs(surveyType).WillReturnRows(sqlmock.NewRows([]string{"survey_type", "name", "json_type", "required", "allowed_values"}))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}).AddRow(reference))
+		mock.ExpectPrepare("UPDATE survey.survey SET survey_ref = .+ WHERE id = .+").ExpectExec().WithArgs(surveyID, reference, shortName, longName, "STA1947", surveyType, "EQ", nil, nil, "{}").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "admin", "SCHEDULED_CHANGE", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.scheduled_change SET state = .+, processed_at = .+").ExpectExec().WithArgs(scheduledChangeID, "APPLIED", "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT id, survey_id, changes, created_by FROM survey.scheduled_change .+").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"id", "survey_id", "changes", "created_by"}))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		applied, err := api.ApplyDueScheduledChanges()
+
+		// Then
+		So(err, ShouldBeNil)
+		So(applied, ShouldEqual, 1)
+	})
+}
+
+func TestApplyDueScheduledChangesFailure(t *testing.T) {
+	Convey("A scheduled change which errors is rolled back and marked as failed so it is not claimed again", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, "SEFT", legalBasisLongName, nil, 3, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT id, survey_id, changes, created_by FROM survey.scheduled_change .+").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"id", "survey_id", "changes", "created_by"}).AddRow(scheduledChangeID, surveyID, []byte(`{"surveyMode":"EQ"}`), "admin"))
+		mock.ExpectExec("SAVEPOINT apply_scheduled_change").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectPrepare("SELECT survey_type, name, json_type, required, allowed_values FROM survey.attribute_definition .+").ExpectQuery().WithArgs(surveyType).WillReturnRows(sqlmock.NewRows([]string{"survey_type", "name", "json_type", "required", "allowed_values"}))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}).AddRow(reference))
+		mock.ExpectPrepare("UPDATE survey.survey SET survey_ref = .+ WHERE id = .+").ExpectExec().WithArgs(surveyID, reference, shortName, longName, "STA1947", surveyType, "EQ", nil, nil, "{}").WillReturnError(errors.New("connection reset"))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT apply_scheduled_change").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectPrepare("UPDATE survey.scheduled_change SET state = .+, processed_at = .+").ExpectExec().WithArgs(scheduledChangeID, "FAILED", "Update survey query failed: connection reset").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT id, survey_id, changes, created_by FROM survey.scheduled_change .+").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"id", "survey_id", "changes", "created_by"}))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		applied, err := api.ApplyDueScheduledChanges()
+
+		// Then
+		So(err, ShouldBeNil)
+		So(applied, ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// RestoreSurvey endpoint handler - brings back the archived survey identified by surveyId
+func (api *API) RestoreSurvey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	surveyID := vars["surveyId"]
+	logger.Info("Restoring survey", zap.String("surveyID", surveyID))
+
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ["+surveyID+"] is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// Lock the survey so it can't change between being checked and restored
+	var before *Survey
+	var lockedVersion int
+	err = tx.Stmt(api.LockSurveyVersionStmt).QueryRow(surveyID).Scan(&lockedVersion)
+	if err == nil {
+		before, err = api.getSurveySnapshot(tx, surveyID)
+	}
+	if err == sql.ErrNoRows {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error retrieving survey by survey ID", http.StatusInternalServerError, err)
+		return
+	}
+
+	if before.ArchivedAt == nil {
+		rollBack(tx)
+		http.Error(w, "The survey is not archived", http.StatusConflict)
+		return
+	}
+
+	if err := api.checkIfMatch(tx, surveyID, r.Header.Get("If-Match")); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	// A survey merged into another keeps its short name and reference, but they now find the other survey
+	for _, alias := range []struct{ kind, name string }{{aliasShortName, before.ShortName}, {aliasRef, before.Reference}} {
+		var owner string
+		err := tx.Stmt(api.GetSurveyAliasStmt).QueryRow(alias.kind, alias.name).Scan(&owner)
+		if err == nil && owner != surveyID {
+			rollBack(tx)
+			http.Error(w, alias.name+" is now an alias of survey "+owner+" so the survey can't be restored", http.StatusConflict)
+			return
+		} else if err != nil && err != sql.ErrNoRows {
+			rollBack(tx)
+			logErrorAndRespond(w, "Failed to check survey aliases", http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if _, err := tx.Stmt(api.RestoreSurveyStmt).Exec(surveyID); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Restore survey query failed", http.StatusInternalServerError, err)
+		return
+	}
+
+	if _, err := api.bumpSurveyVersion(tx, surveyID); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to update survey version", http.StatusInternalServerError, err)
+		return
+	}
+
+	// The survey is returned in the same format as GET /surveys/{surveyId}, with its tags and owner
+	current, err := api.getSurveyInTx(tx, surveyID)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error retrieving restored survey", http.StatusInternalServerError, err)
+		return
+	}
+
+	restored := *before
+	restored.ArchivedAt = nil
+	if err := api.writeAudit(tx, requestActor(r), surveyID, auditRestoreSurvey, before, restored); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey restore", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully restored survey", zap.String("surveyID", surveyID))
+	writeSurvey(w, current)
+}
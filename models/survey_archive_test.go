@@ -0,0 +1,192 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRestoreSurveySuccess(t *testing.T) {
+	Convey("Survey restore brings back an archived survey", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, time.Now(), 1, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		expectNoAliases(mock)
+		mock.ExpectPrepare("UPDATE survey.survey SET archived_at = NULL WHERE id = .+").ExpectExec().WithArgs(surveyID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ARRAY\\(SELECT .+\\) .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows(surveyForUpdateColumns).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, 2, "LIVE", nil, nil, nil, "{BRES}", []byte(`{"division": "ESD", "teamMailbox": "esd@ons.gov.uk"}`)))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "RESTORE_SURVEY", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/restore"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"2"`)
+		So(res.ID, ShouldEqual, surveyID)
+		So(res.ArchivedAt, ShouldBeNil)
+		So(res.Tags, ShouldResemble, []string{"BRES"})
+		So(res.Owner, ShouldNotBeNil)
+		So(res.Owner.Division, ShouldEqual, "ESD")
+	})
+}
+
+func TestRestoreMergedSurveyConflict(t *testing.T) {
+	Convey("Survey restore returns a 409 if the survey was merged into another", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, time.Now(), 1, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectPrepare("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").ExpectQuery().WithArgs("SHORT_NAME", shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_id"}).AddRow("0b1f8376-28e9-4884-bea5-acf9d709464e"))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/restore"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, shortName+" is now an alias of survey 0b1f8376-28e9-4884-bea5-acf9d709464e")
+	})
+}
+
+func TestRestoreSurveyNotArchived(t *testing.T) {
+	Convey("Survey restore returns a 409 if the survey isn't archived", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, 1, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/restore"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+	})
+}
+
+func TestPutArchivedSurveyConflict(t *testing.T) {
+	Convey("Survey PUT returns a 409 if the survey is archived", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, time.Now(), 1, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		body := `{"shortName":"` + shortName + `","longName":"` + longName + `","surveyRef":"` + reference + `","legalBasisRef":"STA1947","surveyType":"Business","surveyMode":"SEFT"}`
+		r, err := http.NewRequest("PUT", url, strings.NewReader(body))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+	})
+}
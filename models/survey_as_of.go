@@ -0,0 +1,36 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// parseAsOf returns the time given in the request's asOf query parameter, or nil if there isn't one
+func parseAsOf(r *http.Request) (*time.Time, error) {
+	v := r.URL.Query().Get("asOf")
+	if v == "" {
+		return nil, nil
+	}
+
+	asOf, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, errors.New("asOf must be a timestamp such as 2024-03-01T00:00:00Z")
+	}
+	return &asOf, nil
+}
+
+// getSurveyAsOf returns the survey identified by surveyID as it was at asOf
+func (api *API) getSurveyAsOf(surveyID string, asOf time.Time) (*Survey, error) {
+	survey := new(Survey)
+	err := api.GetSurveyAsOfStmt.QueryRow(surveyID, asOf).Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis, &survey.Version, &survey.Status, &survey.Periodicity, &survey.PeriodFormat, &survey.Attributes)
+	return survey, err
+}
+
+// getSurveyByReferenceAsOf returns the survey which had the reference surveyRef at asOf, as it was then
+func (api *API) getSurveyByReferenceAsOf(surveyRef string, asOf time.Time) (*Survey, error) {
+	survey := new(Survey)
+	err := api.GetSurveyByReferenceAsOfStmt.QueryRow(surveyRef, asOf).Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis, &survey.Version, &survey.Status, &survey.Periodicity, &survey.PeriodFormat, &survey.Attributes)
+	return survey, err
+}
@@ -0,0 +1,169 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var asOf = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func TestSurveyGetAsOf(t *testing.T) {
+	Convey("Survey GET with asOf returns the survey as it was then", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, "old-shortname", longName, reference, "STA1947", surveyType, "SEFT", legalBasisLongName, 2, "LIVE", nil, nil, nil)
+		mock.ExpectQuery("SELECT h.id, h.short_name, .+ FROM survey.survey_history h .+ WHERE h.id = .+").WithArgs(surveyID, asOf).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "?asOf=2024-03-01T00:00:00Z"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"2"`)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.ShortName, ShouldEqual, "old-shortname")
+		So(res.SurveyMode, ShouldEqual, "SEFT")
+	})
+}
+
+func TestSurveyGetByReferenceAsOfNotFound(t *testing.T) {
+	Convey("Survey GET by reference with asOf returns a 404 if no survey had the reference then", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes"})
+		mock.ExpectQuery("SELECT h.id, h.short_name, .+ FROM survey.survey_history h .+ WHERE LOWER\\(h.survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference, asOf).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/ref/" + reference + "?asOf=2024-03-01T00:00:00Z"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestClassifierTypeSelectorByIDAsOf(t *testing.T) {
+	Convey("ClassifierType GET by ID with asOf returns the classifier types the selector had then", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, 2, "LIVE", nil, nil, nil)
+		rows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE")
+		mock.ExpectQuery("SELECT h.id, h.short_name, .+ FROM survey.survey_history h .+ WHERE h.id = .+").WithArgs(surveyID, asOf).WillReturnRows(surveyRows)
+		mock.ExpectQuery("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type FROM survey.classifiertype_history ct .+").WithArgs(classifierID, asOf).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/classifiertypeselectors/" + classifierID + "?asOf=2024-03-01T00:00:00Z"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.ClassifierTypeSelector{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Name, ShouldEqual, "COLLECTION_INSTRUMENT")
+		So(res.ClassifierTypes, ShouldResemble, []string{"FORM_TYPE"})
+	})
+}
+
+func TestSurveyGetInvalidAsOf(t *testing.T) {
+	Convey("Survey GET returns a 400 if asOf isn't a timestamp", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "?asOf=yesterday"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,327 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// attributeQueryPrefix starts the query parameters of GET /surveys which filter on a custom attribute
+const attributeQueryPrefix = "attributes."
+
+var validAttributeTypes = map[string]bool{"string": true, "number": true, "integer": true, "boolean": true}
+
+var validAttributeName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,49}$`)
+
+// SurveyAttributes holds the custom attributes of a survey, as defined for its survey type. It's stored as JSONB.
+type SurveyAttributes map[string]interface{}
+
+// Scan reads attributes stored as JSONB
+func (a *SurveyAttributes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		return a.unmarshal(v)
+	case string:
+		return a.unmarshal([]byte(v))
+	default:
+		return errors.Errorf("cannot scan %T into survey attributes", src)
+	}
+}
+
+func (a *SurveyAttributes) unmarshal(data []byte) error {
+	var attributes SurveyAttributes
+	if err := json.Unmarshal(data, &attributes); err != nil {
+		return err
+	}
+	// A survey without attributes has an empty object, which we leave out of its JSON
+	if len(attributes) == 0 {
+		attributes = nil
+	}
+	*a = attributes
+	return nil
+}
+
+// Value returns the attributes as JSON to be stored, an empty object if there are none
+func (a SurveyAttributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(a)
+	return string(data), err
+}
+
+// AttributeDefinition describes a custom attribute surveys of a survey type can have
+type AttributeDefinition struct {
+	SurveyType    string        `json:"surveyType"`
+	Name          string        `json:"name"`
+	Type          string        `json:"type"`
+	Required      bool          `json:"required"`
+	AllowedValues []interface{} `json:"allowedValues,omitempty"`
+}
+
+// attributeError describes an attribute of a survey which doesn't match its definition
+type attributeError struct {
+	name    string
+	message string
+}
+
+// matchesAttributeType returns whether a value decoded from JSON is of the given attribute type
+func matchesAttributeType(value interface{}, attributeType string) bool {
+	switch v := value.(type) {
+	case string:
+		return attributeType == "string"
+	case bool:
+		return attributeType == "boolean"
+	case float64:
+		return attributeType == "number" || (attributeType == "integer" && v == math.Trunc(v))
+	default:
+		return false
+	}
+}
+
+// checkAttributes returns what's wrong with the attributes of a survey of surveyType given the definitions for that
+// type, ordered by attribute name
+func checkAttributes(surveyType string, attributes SurveyAttributes, definitions []AttributeDefinition) []attributeError {
+	defined := map[string]AttributeDefinition{}
+	for _, d := range definitions {
+		defined[d.Name] = d
+	}
+
+	var problems []attributeError
+	for name, value := range attributes {
+		definition, ok := defined[name]
+		if !ok {
+			problems = append(problems, attributeError{name, fmt.Sprintf("Attribute %v is not defined for %v surveys", name, surveyType)})
+			continue
+		}
+		if !matchesAttributeType(value, definition.Type) {
+			problems = append(problems, attributeError{name, fmt.Sprintf("Attribute %v must be of type %v", name, definition.Type)})
+			continue
+		}
+		if len(definition.AllowedValues) > 0 && !isAllowedValue(value, definition.AllowedValues) {
+			problems = append(problems, attributeError{name, fmt.Sprintf("Attribute %v must be one of %v", name, formatAllowedValues(definition.AllowedValues))})
+		}
+	}
+
+	for _, d := range definitions {
+		if _, ok := attributes[d.Name]; d.Required && !ok {
+			problems = append(problems, attributeError{d.Name, fmt.Sprintf("Attribute %v is required for %v surveys", d.Name, surveyType)})
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].name < problems[j].name })
+	return problems
+}
+
+func isAllowedValue(value interface{}, allowed []interface{}) bool {
+	for _, a := range allowed {
+		if reflect.DeepEqual(value, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatAllowedValues(allowed []interface{}) string {
+	values := make([]string, len(allowed))
+	for i, a := range allowed {
+		values[i] = fmt.Sprint(a)
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+// getAttributeDefinitions returns the attribute definitions for a survey type, ordered by name
+func (api *API) getAttributeDefinitions(surveyType string) ([]AttributeDefinition, error) {
+	rows, err := api.GetAttributeDefinitionsStmt.Query(surveyType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	definitions := []AttributeDefinition{}
+	for rows.Next() {
+		var definition AttributeDefinition
+		var allowedValues []byte
+		if err := rows.Scan(&definition.SurveyType, &definition.Name, &definition.Type, &definition.Required, &allowedValues); err != nil {
+			return nil, err
+		}
+		if allowedValues != nil {
+			if err := json.Unmarshal(allowedValues, &definition.AllowedValues); err != nil {
+				return nil, err
+			}
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, rows.Err()
+}
+
+// attributeDefinitionPath returns the survey type and attribute name in the request path, or writes a 400 response
+// and returns false if either is invalid
+func attributeDefinitionPath(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	vars := mux.Vars(r)
+	surveyType, ok := surveyTypes[strings.ToLower(vars["surveyType"])]
+	if !ok {
+		http.Error(w, "Survey type must be one of [Census, Business, Social]", http.StatusBadRequest)
+		return "", "", false
+	}
+
+	name, hasName := vars["name"]
+	if hasName && !validAttributeName.MatchString(name) {
+		http.Error(w, "Attribute names must be 1 to 50 letters, digits or underscores, starting with a letter", http.StatusBadRequest)
+		return "", "", false
+	}
+	return surveyType, name, true
+}
+
+// AllAttributeDefinitions endpoint handler - returns the custom attributes defined for a survey type
+func (api *API) AllAttributeDefinitions(w http.ResponseWriter, r *http.Request) {
+	surveyType, _, ok := attributeDefinitionPath(w, r)
+	if !ok {
+		return
+	}
+
+	definitions, err := api.getAttributeDefinitions(surveyType)
+	if err != nil {
+		logErrorAndRespond(w, "Failed to get attribute definitions", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(definitions); err != nil {
+		logError("Error encoding response to 'get attribute definitions'", err)
+	}
+}
+
+// PutAttributeDefinition endpoint handler - defines, or redefines, a custom attribute for a survey type. Surveys are
+// checked against the new definition when they're next created or updated, so an attribute can only be required once
+// every survey of the type has it.
+func (api *API) PutAttributeDefinition(w http.ResponseWriter, r *http.Request) {
+	surveyType, name, ok := attributeDefinitionPath(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading request body", http.StatusInternalServerError, err)
+		return
+	}
+	var definition AttributeDefinition
+	if err := json.Unmarshal(body, &definition); err != nil {
+		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
+	}
+	definition.SurveyType = surveyType
+	definition.Name = name
+
+	if !validAttributeTypes[definition.Type] {
+		http.Error(w, "type must be one of [string, number, integer, boolean]", http.StatusBadRequest)
+		return
+	}
+	for _, v := range definition.AllowedValues {
+		if !matchesAttributeType(v, definition.Type) {
+			http.Error(w, fmt.Sprintf("Allowed value %v is not of type %v", v, definition.Type), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if definition.Required {
+		var missing int
+		if err := api.CountSurveysWithoutAttributeStmt.QueryRow(surveyType, name).Scan(&missing); err != nil {
+			logErrorAndRespond(w, "Failed to check attribute usage", http.StatusInternalServerError, err)
+			return
+		}
+		if missing > 0 {
+			http.Error(w, fmt.Sprintf("Attribute %v can't be required as %d %v surveys don't have it", name, missing, surveyType), http.StatusConflict)
+			return
+		}
+	}
+
+	var allowedValues interface{}
+	if len(definition.AllowedValues) > 0 {
+		data, err := json.Marshal(definition.AllowedValues)
+		if err != nil {
+			logErrorAndRespond(w, "Error marshalling allowed values", http.StatusInternalServerError, err)
+			return
+		}
+		allowedValues = string(data)
+	}
+
+	if _, err := api.PutAttributeDefinitionStmt.Exec(surveyType, name, definition.Type, definition.Required, allowedValues, requestActor(r)); err != nil {
+		logErrorAndRespond(w, "Failed to save attribute definition", http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("Attribute defined", zap.String("survey_type", surveyType), zap.String("name", name), zap.String("type", definition.Type))
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(definition); err != nil {
+		logError("Error encoding response to 'put attribute definition'", err)
+	}
+}
+
+// DeleteAttributeDefinition endpoint handler - removes a custom attribute from a survey type. Attributes still used
+// by a survey can't be removed.
+func (api *API) DeleteAttributeDefinition(w http.ResponseWriter, r *http.Request) {
+	surveyType, name, ok := attributeDefinitionPath(w, r)
+	if !ok {
+		return
+	}
+
+	var used int
+	if err := api.CountSurveysWithAttributeStmt.QueryRow(surveyType, name).Scan(&used); err != nil {
+		logErrorAndRespond(w, "Failed to check attribute usage", http.StatusInternalServerError, err)
+		return
+	}
+	if used > 0 {
+		http.Error(w, fmt.Sprintf("Attribute %v is used by %d %v surveys", name, used, surveyType), http.StatusConflict)
+		return
+	}
+
+	result, err := api.DeleteAttributeDefinitionStmt.Exec(surveyType, name)
+	if err != nil {
+		logErrorAndRespond(w, "Failed to delete attribute definition", http.StatusInternalServerError, err)
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		writeRestErrorResponse(w, "Attribute definition not found", http.StatusNotFound)
+		return
+	}
+
+	logger.Info("Attribute definition deleted", zap.String("survey_type", surveyType), zap.String("name", name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseAttributeFilters adds a condition to q for each attributes.<name> query parameter, matching surveys whose
+// attribute has the given value
+func (q *surveyListQuery) parseAttributeFilters(values map[string][]string) error {
+	var names []string
+	for key := range values {
+		if strings.HasPrefix(key, attributeQueryPrefix) {
+			names = append(names, strings.TrimPrefix(key, attributeQueryPrefix))
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !validAttributeName.MatchString(name) {
+			return errors.Errorf("'%s' is not a valid attribute name", name)
+		}
+		q.args = append(q.args, name, values[attributeQueryPrefix+name][0])
+		q.conditions = append(q.conditions, fmt.Sprintf("s.attributes ->> $%d = $%d", len(q.args)-1, len(q.args)))
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var attributeDefinitionColumns = []string{"survey_type", "name", "json_type", "required", "allowed_values"}
+
+func TestCreateNewSurveyRejectsAttributeNotAllowed(t *testing.T) {
+	Convey("Create new survey returns a 400 if an attribute isn't one of its allowed values", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		mock.ExpectQuery("SELECT survey_type, name, json_type, required, allowed_values FROM survey.attribute_definition .+").WithArgs(surveyType).
+			WillReturnRows(sqlmock.NewRows(attributeDefinitionColumns).AddRow(surveyType, "sampleFrameSource", "string", true, []byte(`["IDBR", "ONS"]`)))
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "` + reference + `", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "SEFT",
+			"attributes": {"sampleFrameSource": "PAF"}}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldContainSubstring, "Attribute sampleFrameSource must be one of [IDBR, ONS]")
+	})
+}
+
+func TestValidateSurveyReportsAttributeProblems(t *testing.T) {
+	Convey("Survey validate reports each attribute which doesn't match its definition", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		mock.ExpectQuery("SELECT survey_type, name, json_type, required, allowed_values FROM survey.attribute_definition .+").WithArgs(surveyType).
+			WillReturnRows(sqlmock.NewRows(attributeDefinitionColumns).
+				AddRow(surveyType, "employment", "integer", false, nil).
+				AddRow(surveyType, "sampleFrameSource", "string", true, nil))
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys:validate"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "` + reference + `", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "SEFT",
+			"attributes": {"employment": 2.5, "region": "Wales"}}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.SurveyValidation{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Valid, ShouldBeFalse)
+		So(res.Errors, ShouldResemble, []models.FieldError{
+			{Field: "attributes.employment", Message: "Attribute employment must be of type integer"},
+			{Field: "attributes.region", Message: "Attribute region is not defined for Business surveys"},
+			{Field: "attributes.sampleFrameSource", Message: "Attribute sampleFrameSource is required for Business surveys"},
+		})
+	})
+}
+
+func TestPutAttributeDefinition(t *testing.T) {
+	Convey("Attribute definition PUT saves the definition for the survey type and returns it", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM survey.survey WHERE survey_type = .+ AND NOT attributes .+").WithArgs("Business", "sampleFrameSource").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectExec("INSERT INTO survey.attribute_definition .+").WithArgs("Business", "sampleFrameSource", "string", true, `["IDBR","ONS"]`, "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveytypes/business/attributes/sampleFrameSource"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("PUT", url, strings.NewReader(`{"type": "string", "required": true, "allowedValues": ["IDBR", "ONS"]}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.AttributeDefinition{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res, ShouldResemble, models.AttributeDefinition{SurveyType: "Business", Name: "sampleFrameSource", Type: "string", Required: true, AllowedValues: []interface{}{"IDBR", "ONS"}})
+	})
+}
+
+func TestPutAttributeDefinitionInvalidAllowedValue(t *testing.T) {
+	Convey("Attribute definition PUT returns a 400 if an allowed value isn't of the attribute's type", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveytypes/Business/attributes/employment"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("PUT", url, strings.NewReader(`{"type": "integer", "allowedValues": [10, 2.5]}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+	})
+}
+
+func TestPutRequiredAttributeDefinitionMissingFromSurveys(t *testing.T) {
+	Convey("Attribute definition PUT returns a 409 if a required attribute is missing from existing surveys", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM survey.survey WHERE survey_type = .+ AND NOT attributes .+").WithArgs("Business", "sampleFrameSource").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveytypes/Business/attributes/sampleFrameSource"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("PUT", url, strings.NewReader(`{"type": "string", "required": true}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, "Attribute sampleFrameSource can't be required as 3 Business surveys don't have it")
+	})
+}
+
+func TestDeleteAttributeDefinitionInUse(t *testing.T) {
+	Convey("Attribute definition DELETE returns a 409 if surveys still have the attribute", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM survey.survey WHERE survey_type = .+ AND attributes .+").WithArgs("Business", "sampleFrameSource").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveytypes/Business/attributes/sampleFrameSource"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("DELETE", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+	})
+}
+
+func TestSurveyListFilteredByAttribute(t *testing.T) {
+	Convey("Surveys list returns the surveys whose attribute has the given value", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).
+			AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, "LIVE", nil, nil, []byte(`{"sampleFrameSource": "IDBR"}`), nil, nil)
+		mock.ExpectQuery("SELECT id, s.short_name, .+ WHERE s.attributes ->> \\$1 = \\$2 AND s.archived_at IS NULL ORDER BY s.short_name ASC, s.id ASC").
+			WithArgs("sampleFrameSource", "IDBR").WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys?attributes.sampleFrameSource=IDBR"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		var res []models.Survey
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res, ShouldHaveLength, 1)
+		So(res[0].Attributes, ShouldResemble, models.SurveyAttributes{"sampleFrameSource": "IDBR"})
+	})
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// SurveyClone holds the details which differ between a survey and its clone. ID is optional.
+type SurveyClone struct {
+	ID        string `json:"id"`
+	Reference string `json:"surveyRef"`
+	ShortName string `json:"shortName"`
+	LongName  string `json:"longName"`
+}
+
+// CloneSurvey endpoint handler - creates a new survey with the type, mode, legal basis, periodicity, period format,
+// attributes and classifiers of the survey identified by surveyId, and the reference, short name and long name in the
+// request. The clone starts in DESIGN like any new survey. Its tags, owner, translations and external identifiers
+// aren't copied, as they describe the source survey rather than its design; external identifiers couldn't be anyway,
+// as each belongs to one survey.
+func (api *API) CloneSurvey(w http.ResponseWriter, r *http.Request) {
+	sourceID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(sourceID); err != nil {
+		http.Error(w, "The value ("+sourceID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading request body", http.StatusInternalServerError, err)
+		return
+	}
+	var details SurveyClone
+	if err := json.Unmarshal(body, &details); err != nil {
+		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	source, err := api.getSurveySnapshot(tx, sourceID)
+	if err == sql.ErrNoRows || (err == nil && source.ArchivedAt != nil) {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error getting survey to clone", http.StatusInternalServerError, err)
+		return
+	}
+
+	// The clone gets new UUIDs for its classifier type selectors
+	clone := Survey{
+		ID:            details.ID,
+		ShortName:     details.ShortName,
+		LongName:      details.LongName,
+		Reference:     details.Reference,
+		SurveyType:    source.SurveyType,
+		SurveyMode:    source.SurveyMode,
+		LegalBasisRef: source.LegalBasisRef,
+		Periodicity:   source.Periodicity,
+		PeriodFormat:  source.PeriodFormat,
+		Attributes:    source.Attributes,
+		Classifiers:   make([]ClassifierTypeSelector, len(source.Classifiers)),
+	}
+	for i, c := range source.Classifiers {
+		clone.Classifiers[i] = ClassifierTypeSelector{Name: c.Name, ClassifierTypes: c.ClassifierTypes}
+	}
+
+	legalBasis, reqErr := api.firstSurveyProblem(&clone, "")
+	if reqErr != nil {
+		rollBack(tx)
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+	clone.LegalBasis = legalBasis.LongName
+
+	if clone.ID == "" {
+		cloneID, err := uuid.NewV4()
+		if err != nil {
+			rollBack(tx)
+			http.Error(w, "Error generating random uuid", http.StatusInternalServerError)
+			return
+		}
+		clone.ID = cloneID.String()
+	}
+
+	version, err := api.insertSurvey(tx, &clone, requestActor(r))
+	if isUniqueViolation(err) {
+		rollBack(tx)
+		http.Error(w, "A survey with the same id, short name or reference already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Clone survey failed", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Survey cloned", zap.String("source_survey_id", sourceID), zap.String("survey_id", clone.ID))
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", surveyETag(version))
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(clone); err != nil {
+		logError("Error encoding response to 'clone survey'", err)
+	}
+}
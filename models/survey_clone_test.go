@@ -0,0 +1,160 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCloneSurveySuccess(t *testing.T) {
+	Convey("Survey clone copies a survey and its classifiers under a new reference and name", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, "VACS2", "Vacancy Survey 2", "182", "STA1947", surveyType, "EQ", legalBasisLongName, nil, 7, "LIVE", "MONTHLY", "YYYYMM", nil)
+		classifierRows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE").AddRow("a9b1d9e8-1c0c-4c8e-8a70-4f6d2e6a0c11", "COMMUNICATION", "RU_REF")
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(classifierRows)
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectPrepare("SELECT survey_type, name, json_type, required, allowed_values FROM survey.attribute_definition .+").ExpectQuery().WithArgs(surveyType).WillReturnRows(sqlmock.NewRows([]string{"survey_type", "name", "json_type", "required", "allowed_values"}))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs("VACS3").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs("183").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectPrepare("INSERT INTO survey.survey .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), "183", "VACS3", "Vacancy Survey 3", "STA1947", surveyType, "EQ", "MONTHLY", "YYYYMM", "{}").WillReturnRows(sqlmock.NewRows([]string{"survey_pk", "version", "status"}).AddRow(1001, 1, "DESIGN"))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(sqlmock.AnyArg(), "unknown", "CREATE_SURVEY", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertypeselector .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), 1001, "COLLECTION_INSTRUMENT").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertype .+").ExpectExec().WithArgs(11, "FORM_TYPE").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(sqlmock.AnyArg(), "unknown", "CREATE_CLASSIFIER", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertypeselector .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), 1001, "COMMUNICATION").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(12))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertype .+").ExpectExec().WithArgs(12, "RU_REF").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(sqlmock.AnyArg(), "unknown", "CREATE_CLASSIFIER", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/clone"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(`{"surveyRef": "183", "shortName": "VACS3", "longName": "Vacancy Survey 3"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"1"`)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.ID, ShouldNotBeEmpty)
+		So(res.ID, ShouldNotEqual, surveyID)
+		So(res.ShortName, ShouldEqual, "VACS3")
+		So(res.Status, ShouldEqual, "DESIGN")
+		So(*res.Periodicity, ShouldEqual, "MONTHLY")
+		So(*res.PeriodFormat, ShouldEqual, "YYYYMM")
+		So(res.Classifiers, ShouldHaveLength, 2)
+		So(res.Classifiers[0].Name, ShouldEqual, "COLLECTION_INSTRUMENT")
+		So(res.Classifiers[0].ID, ShouldNotEqual, classifierID)
+	})
+}
+
+func TestCloneSurveyNotFound(t *testing.T) {
+	Convey("Survey clone returns a 404 if the survey to clone doesn't exist", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/clone"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(`{"surveyRef": "183", "shortName": "VACS3", "longName": "Vacancy Survey 3"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestCloneSurveyDuplicateShortName(t *testing.T) {
+	Convey("Survey clone returns a 409 if the short name is already used", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, "VACS2", "Vacancy Survey 2", "182", "STA1947", surveyType, "EQ", legalBasisLongName, nil, 7, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectPrepare("SELECT survey_type, name, json_type, required, allowed_values FROM survey.attribute_definition .+").ExpectQuery().WithArgs(surveyType).WillReturnRows(sqlmock.NewRows([]string{"survey_type", "name", "json_type", "required", "allowed_values"}))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs("VACS2").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}).AddRow("182"))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/clone"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(`{"surveyRef": "183", "shortName": "VACS2", "longName": "Vacancy Survey 3"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+	})
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
+	validator2 "gopkg.in/go-playground/validator.v9"
+)
+
+// ClassifierRejection describes why a classifier type selector, or one of its classifier types, was rejected.
+// Index is the position of the selector in the request's list of classifiers.
+type ClassifierRejection struct {
+	Index                  int    `json:"index"`
+	ClassifierTypeSelector string `json:"classifierTypeSelector"`
+	ClassifierType         string `json:"classifierType,omitempty"`
+	Reason                 string `json:"reason"`
+}
+
+// ClassifierRejectionError is the error returned when a new survey's classifiers fail to validate
+type ClassifierRejectionError struct {
+	RESTError
+	Rejections []ClassifierRejection `json:"rejections"`
+}
+
+// checkClassifiers runs the checks classifiers must pass before any of them are written to the database, returning
+// every problem found rather than just the first. Each classifier type selector is checked against its validate rules,
+// so every request which writes classifiers applies the same ones.
+func (api *API) checkClassifiers(classifiers []ClassifierTypeSelector) []ClassifierRejection {
+	rejections := []ClassifierRejection{}
+	selectors := map[string]bool{}
+	ids := map[string]bool{}
+	for i, c := range classifiers {
+		reject := func(classifierType, reason string) {
+			rejections = append(rejections, ClassifierRejection{Index: i, ClassifierTypeSelector: c.Name, ClassifierType: classifierType, Reason: reason})
+		}
+
+		// Field errors are keyed by field, e.g. Name or ClassifierTypes[1], so they can be reported in order
+		fieldErrors := map[string]validator2.FieldError{}
+		if err := api.Validator.Struct(c); err != nil {
+			validationErrors, ok := err.(validator2.ValidationErrors)
+			if !ok {
+				reject("", "Classifier type selector failed to validate - "+err.Error())
+				continue
+			}
+			for _, fe := range validationErrors {
+				fieldErrors[fe.StructField()] = fe
+			}
+		}
+
+		if fe, ok := fieldErrors["Name"]; ok {
+			reject("", "Classifier type selector name "+classifierRuleMessage(fe))
+		} else if selectors[c.Name] {
+			reject("", "Classifier type selector is given more than once")
+		}
+		selectors[c.Name] = true
+
+		if c.ID != "" {
+			if _, err := uuid.FromString(c.ID); err != nil {
+				reject("", "Classifier type selector id "+c.ID+" is not a valid UUID")
+			} else if ids[strings.ToLower(c.ID)] {
+				reject("", "Classifier type selector id "+c.ID+" is given more than once")
+			}
+			ids[strings.ToLower(c.ID)] = true
+		}
+
+		if _, ok := fieldErrors["ClassifierTypes"]; ok {
+			reject("", "Classifier type selector must have at least one classifier type")
+		}
+
+		types := map[string]bool{}
+		for j, classifierType := range c.ClassifierTypes {
+			if fe, ok := fieldErrors[fmt.Sprintf("ClassifierTypes[%d]", j)]; ok {
+				reject(classifierType, "Classifier type "+classifierRuleMessage(fe))
+			} else if types[classifierType] {
+				reject(classifierType, "Classifier type is given more than once")
+			}
+			types[classifierType] = true
+		}
+	}
+	return rejections
+}
+
+// classifierRuleMessage describes a failed Validator rule for a classifier type selector or classifier type name
+func classifierRuleMessage(fe validator2.FieldError) string {
+	if fe.Tag() == "required" || (fe.Tag() == "min" && fe.Param() == "1") {
+		return "must not be empty"
+	}
+	return strings.TrimPrefix(validationMessage(fe), "Value ")
+}
+
+// checkClassifierIDsUnused returns a rejection for each classifier type selector whose supplied id is already used
+func (api *API) checkClassifierIDsUnused(classifiers []ClassifierTypeSelector) ([]ClassifierRejection, error) {
+	rejections := []ClassifierRejection{}
+	ids := []string{}
+	for _, c := range classifiers {
+		if id := uuid.FromStringOrNil(c.ID); id != uuid.Nil {
+			ids = append(ids, id.String())
+		}
+	}
+	if len(ids) == 0 {
+		return rejections, nil
+	}
+
+	rows, err := api.GetExistingClassifierTypeSelectorIDs.Query(pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		existing[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, c := range classifiers {
+		if id := uuid.FromStringOrNil(c.ID); id != uuid.Nil && existing[id] {
+			rejections = append(rejections, ClassifierRejection{Index: i, ClassifierTypeSelector: c.Name, Reason: "Classifier type selector id " + c.ID + " already exists"})
+		}
+	}
+	return rejections, nil
+}
+
+// writeClassifierRejections sends a response with the given status listing the rejected classifiers
+func writeClassifierRejections(w http.ResponseWriter, status int, message string, rejections []ClassifierRejection) {
+	response := ClassifierRejectionError{
+		RESTError:  NewRESTError(strconv.Itoa(status), message),
+		Rejections: rejections,
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		logErrorAndRespond(w, "Error marshalling classifier rejections JSON", http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// insertSurvey inserts a new survey and its classifiers using transaction tx and audits them, returning the survey's
+// version. The survey must already have its ID and a resolved legal basis; its status and the IDs of its classifiers
+// are filled in.
+func (api *API) insertSurvey(tx *sql.Tx, survey *Survey, actor string) (int, error) {
+	surveyPK, version := 0, 0
+	err := tx.Stmt(api.CreateSurveyStmt).QueryRow(
+		survey.ID,
+		survey.Reference,
+		survey.ShortName,
+		survey.LongName,
+		survey.LegalBasisRef,
+		survey.SurveyType,
+		survey.SurveyMode,
+		survey.Periodicity,
+		survey.PeriodFormat,
+		survey.Attributes,
+	).Scan(&surveyPK, &version, &survey.Status)
+	if err != nil {
+		return 0, err
+	}
+
+	surveyDetails := *survey
+	surveyDetails.Classifiers = nil
+	if err := api.writeAudit(tx, actor, survey.ID, auditCreateSurvey, nil, surveyDetails); err != nil {
+		return 0, err
+	}
+
+	for i, c := range survey.Classifiers {
+		if survey.Classifiers[i].ID, err = api.insertClassifier(tx, surveyPK, survey.ID, c, actor); err != nil {
+			return 0, err
+		}
+	}
+	return version, nil
+}
+
+// insertClassifier inserts a classifier type selector and its classifier types for a survey using transaction tx and
+// audits it, returning the UUID of the selector. The selector keeps its ID if it has one, otherwise a new one is
+// generated. The survey's version isn't changed.
+func (api *API) insertClassifier(tx *sql.Tx, surveyPK int, surveyID string, classifier ClassifierTypeSelector, actor string) (string, error) {
+	typeSelectorPK, classifierTypeSelectorID, err := api.insertClassifierTypeSelector(classifier.Name, surveyPK, uuid.FromStringOrNil(classifier.ID), tx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := api.insertClassifierTypes(classifier.ClassifierTypes, typeSelectorPK, tx); err != nil {
+		return "", err
+	}
+
+	classifier.ID = classifierTypeSelectorID.String()
+	if err := api.writeAudit(tx, actor, surveyID, auditCreateClassifier, nil, classifier); err != nil {
+		return "", err
+	}
+	return classifier.ID, nil
+}
+
+// isUniqueViolation returns true if err is from a write which broke a unique constraint, such as when another
+// request created a survey with the same short name after it was checked
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
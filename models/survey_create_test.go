@@ -0,0 +1,287 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCreateNewSurveyRejectsClassifiers(t *testing.T) {
+	Convey("Create new survey lists every rejected classifier and writes nothing", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "` + reference + `", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "SEFT",
+			"classifiers": [
+				{"name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE", "FORM_TYPE"]},
+				{"name": "COMMUNICATION", "classifierTypes": []},
+				{"name": "COLLECTION_INSTRUMENT", "classifierTypes": ["RU REF"]}
+			]}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		res := models.ClassifierRejectionError{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Code, ShouldEqual, "400")
+		So(res.Rejections, ShouldResemble, []models.ClassifierRejection{
+			{Index: 0, ClassifierTypeSelector: "COLLECTION_INSTRUMENT", ClassifierType: "FORM_TYPE", Reason: "Classifier type is given more than once"},
+			{Index: 1, ClassifierTypeSelector: "COMMUNICATION", Reason: "Classifier type selector must have at least one classifier type"},
+			{Index: 2, ClassifierTypeSelector: "COLLECTION_INSTRUMENT", Reason: "Classifier type selector is given more than once"},
+			{Index: 2, ClassifierTypeSelector: "COLLECTION_INSTRUMENT", ClassifierType: "RU REF", Reason: "Classifier type must not contain spaces"},
+		})
+	})
+}
+
+func TestCreateNewSurveyClassifierFailureRollsBack(t *testing.T) {
+	Convey("Create new survey rolls back the survey if a classifier can't be inserted", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectBegin()
+		mock.ExpectPrepare("INSERT INTO survey.survey .+").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"survey_pk", "version", "status"}).AddRow(1000, 1, "DESIGN"))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(sqlmock.AnyArg(), "unknown", "CREATE_SURVEY", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertypeselector .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), 1000, "COLLECTION_INSTRUMENT").WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "` + reference + `", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "SEFT",
+			"classifiers": [{"name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE"]}]}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusInternalServerError)
+	})
+}
+
+func TestCreateNewSurveyRejectsTagsAndOwner(t *testing.T) {
+	Convey("Create new survey returns a 400 rather than dropping tags or an owner", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "` + reference + `", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "SEFT",
+			"tags": ["economic"], "owner": {"division": "Business Surveys", "teamMailbox": "bres@ons.gov.uk"}}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, "The tags of a survey are added with PUT /surveys/{surveyId}/tags/{tag} once it's created")
+	})
+}
+
+func TestCreateNewSurveyWithSuppliedIDs(t *testing.T) {
+	Convey("Create new survey keeps the survey and classifier type selector ids it's given", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM survey.survey WHERE id = .+\\)").WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery("SELECT id FROM survey.classifiertypeselector WHERE id = ANY\\(.+\\)").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectBegin()
+		mock.ExpectPrepare("INSERT INTO survey.survey .+").ExpectQuery().WithArgs(surveyID, reference, shortName, longName, "STA1947", "Business", "SEFT", nil, nil, "{}").WillReturnRows(sqlmock.NewRows([]string{"survey_pk", "version", "status"}).AddRow(1000, 1, "DESIGN"))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "CREATE_SURVEY", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertypeselector .+").ExpectQuery().WithArgs(classifierID, 1000, "COLLECTION_INSTRUMENT").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertype .+").ExpectExec().WithArgs(1, "FORM_TYPE").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "CREATE_CLASSIFIER", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"id": "` + surveyID + `", "shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "` + reference + `", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "SEFT",
+			"classifiers": [{"id": "` + classifierID + `", "name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE"]}]}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.ID, ShouldEqual, surveyID)
+		So(res.Classifiers[0].ID, ShouldEqual, classifierID)
+	})
+}
+
+func TestCreateNewSurveyWithExistingID(t *testing.T) {
+	Convey("Create new survey returns a 409 if a survey already has the id it's given", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM survey.survey WHERE id = .+\\)").WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"id": "` + surveyID + `", "shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "` + reference + `", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "SEFT"}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, "Survey with id "+surveyID+" already exists")
+	})
+}
+
+func TestCreateNewSurveyClassifiersWithExistingID(t *testing.T) {
+	Convey("Create new survey classifiers returns a 409 if a classifier type selector already has the id it's given", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectQuery("SELECT survey_pk FROM survey.survey WHERE id = .+").WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"survey_pk"}).AddRow(1000))
+		mock.ExpectQuery("SELECT id FROM survey.classifiertypeselector WHERE id = ANY\\(.+\\)").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(classifierID))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/classifiers"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(`{"id": "`+classifierID+`", "name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE"]}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+	})
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// deleteConfirmationTTL is how long the confirmation token from a delete preview can be used to delete the survey
+const deleteConfirmationTTL = 5 * time.Minute
+
+// confirmationTokenParam is the query parameter a delete gives the confirmation token from a delete preview in
+const confirmationTokenParam = "confirmationToken"
+
+// DeletePreview represents everything that permanently deleting a survey would remove, and the token needed to do it
+type DeletePreview struct {
+	SurveyID                    string                   `json:"surveyId"`
+	ShortName                   string                   `json:"shortName"`
+	Version                     int                      `json:"version"`
+	ClassifierTypeSelectorCount int                      `json:"classifierTypeSelectorCount"`
+	ClassifierTypeCount         int                      `json:"classifierTypeCount"`
+	ClassifierTypeSelectors     []ClassifierTypeSelector `json:"classifierTypeSelectors"`
+	ScheduledChangeCount        int                      `json:"scheduledChangeCount"`
+	AliasCount                  int                      `json:"aliasCount"`
+	TagCount                    int                      `json:"tagCount"`
+	OwnerCount                  int                      `json:"ownerCount"`
+	TranslationCount            int                      `json:"translationCount"`
+	ExternalIDCount             int                      `json:"externalIdCount"`
+	ConfirmationToken           string                   `json:"confirmationToken"`
+	ExpiresAt                   time.Time                `json:"expiresAt"`
+}
+
+// GetDeletePreview endpoint handler - returns what would be removed along with the survey by
+// DELETE /surveys/{surveyId}?purge=true, with a short-lived token which DELETE /surveys/{surveyId} must give to go
+// ahead, whether it archives or purges the survey
+func (api *API) GetDeletePreview(w http.ResponseWriter, r *http.Request) {
+	surveyID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// Archived surveys can still be purged, so they can be previewed too
+	survey, err := api.getSurveySnapshot(tx, surveyID)
+	if err == sql.ErrNoRows {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error retrieving survey by survey ID", http.StatusInternalServerError, err)
+		return
+	}
+
+	preview := DeletePreview{
+		SurveyID:                survey.ID,
+		ShortName:               survey.ShortName,
+		Version:                 survey.Version,
+		ClassifierTypeSelectors: survey.Classifiers,
+	}
+	if preview.ClassifierTypeSelectors == nil {
+		preview.ClassifierTypeSelectors = []ClassifierTypeSelector{}
+	}
+	preview.ClassifierTypeSelectorCount = len(preview.ClassifierTypeSelectors)
+	for _, c := range preview.ClassifierTypeSelectors {
+		preview.ClassifierTypeCount += len(c.ClassifierTypes)
+	}
+
+	err = tx.Stmt(api.CountSurveyDependentsStmt).QueryRow(surveyID).Scan(&preview.ScheduledChangeCount, &preview.AliasCount,
+		&preview.TagCount, &preview.OwnerCount, &preview.TranslationCount, &preview.ExternalIDCount)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error counting survey dependents", http.StatusInternalServerError, err)
+		return
+	}
+
+	token, err := uuid.NewV4()
+	if err != nil {
+		rollBack(tx)
+		http.Error(w, "Error generating random uuid", http.StatusInternalServerError)
+		return
+	}
+	preview.ConfirmationToken = token.String()
+	preview.ExpiresAt = time.Now().UTC().Add(deleteConfirmationTTL).Truncate(time.Second)
+
+	if _, err := tx.Stmt(api.DeleteExpiredDeleteConfirmationsStmt).Exec(); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error removing expired confirmation tokens", http.StatusInternalServerError, err)
+		return
+	}
+	_, err = tx.Stmt(api.CreateDeleteConfirmationStmt).Exec(preview.ConfirmationToken, surveyID, survey.Version, requestActor(r), preview.ExpiresAt)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error saving confirmation token", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Previewed survey deletion", zap.String("survey_id", surveyID), zap.Int("classifier_type_selectors", preview.ClassifierTypeSelectorCount))
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(preview); err != nil {
+		logError("Error encoding response to 'delete preview'", err)
+	}
+}
+
+// useDeleteConfirmation checks token came from a delete preview of the survey at the given version which hasn't
+// expired, and uses it up so it can't be given again
+func (api *API) useDeleteConfirmation(tx *sql.Tx, token, surveyID string, version int) *requestError {
+	if token == "" {
+		return newRequestError(http.StatusPreconditionRequired, "A %v from GET /surveys/%v/delete-preview is required to delete a survey", confirmationTokenParam, surveyID)
+	}
+	if _, err := uuid.FromString(token); err != nil {
+		return newRequestError(http.StatusPreconditionRequired, "The %v is not valid", confirmationTokenParam)
+	}
+
+	var previewed int
+	err := tx.Stmt(api.UseDeleteConfirmationStmt).QueryRow(token, surveyID).Scan(&previewed)
+	if err == sql.ErrNoRows {
+		return newRequestError(http.StatusPreconditionRequired, "The %v is not valid or has expired", confirmationTokenParam)
+	} else if err != nil {
+		return newRequestError(http.StatusInternalServerError, "Error checking %v - %v", confirmationTokenParam, err)
+	}
+
+	if previewed != version {
+		return newRequestError(http.StatusConflict, "The survey has changed since it was previewed")
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const confirmationToken = "5d6b3c8e-7f4a-4e0b-9b8c-2a1f0e9d8c7b"
+
+func TestDeletePreviewSuccess(t *testing.T) {
+	Convey("Survey delete preview returns what a purge would remove and a confirmation token", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, 3, "LIVE", nil, nil, nil)
+		classifierRows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE").AddRow("a9b1d9e8-1c0c-4c8e-8a70-4f6d2e6a0c11", "COMMUNICATION", "RU_REF").AddRow("a9b1d9e8-1c0c-4c8e-8a70-4f6d2e6a0c11", "COMMUNICATION", "REGION")
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(classifierRows)
+		mock.ExpectPrepare("SELECT \\(SELECT COUNT\\(\\*\\) FROM survey.scheduled_change .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"count", "count", "count", "count", "count", "count"}).AddRow(1, 2, 3, 1, 4, 2))
+		mock.ExpectPrepare("DELETE FROM survey.delete_confirmation WHERE expires_at < now\\(\\)").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectPrepare("INSERT INTO survey.delete_confirmation .+").ExpectExec().WithArgs(sqlmock.AnyArg(), surveyID, 3, "unknown", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/delete-preview"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.DeletePreview{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Version, ShouldEqual, 3)
+		So(res.ClassifierTypeSelectorCount, ShouldEqual, 2)
+		So(res.ClassifierTypeCount, ShouldEqual, 3)
+		So(res.ClassifierTypeSelectors[1].Name, ShouldEqual, "COMMUNICATION")
+		So(res.ScheduledChangeCount, ShouldEqual, 1)
+		So(res.AliasCount, ShouldEqual, 2)
+		So(res.TagCount, ShouldEqual, 3)
+		So(res.OwnerCount, ShouldEqual, 1)
+		So(res.TranslationCount, ShouldEqual, 4)
+		So(res.ExternalIDCount, ShouldEqual, 2)
+		So(res.ConfirmationToken, ShouldNotBeEmpty)
+		So(res.ExpiresAt.IsZero(), ShouldBeFalse)
+	})
+}
+
+func TestSurveyDeletePurgeWithoutConfirmationToken(t *testing.T) {
+	Convey("Survey Delete by id with purge returns a 428 without a confirmation token", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, 3, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "?purge=true"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("DELETE", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusPreconditionRequired)
+	})
+}
+
+func TestSurveyDeleteArchiveWithoutConfirmationToken(t *testing.T) {
+	Convey("Survey Delete by id returns a 428 without a confirmation token even when it only archives the survey", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, 3, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("DELETE", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusPreconditionRequired)
+	})
+}
+
+func TestSurveyDeletePurgeChangedSincePreview(t *testing.T) {
+	Convey("Survey Delete by id with purge returns a 409 if the survey has changed since it was previewed", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, 4, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectPrepare("DELETE FROM survey.delete_confirmation WHERE token = .+").ExpectQuery().WithArgs(confirmationToken, surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "?purge=true&confirmationToken=" + confirmationToken
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("DELETE", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+	})
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// surveyExportSelect selects the same columns as surveyListSelect followed by each survey's classifiers as JSON
+const surveyExportSelect = "SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.status, s.periodicity, s.period_format, " +
+	"(SELECT json_agg(json_build_object('id', cts.id, 'name', cts.classifier_type_selector, 'classifierTypes', " +
+	"(SELECT json_agg(ct.classifier_type ORDER BY ct.classifier_type) FROM survey.classifiertype ct WHERE ct.classifier_type_selector_fk = cts.classifier_type_selector_pk)) " +
+	"ORDER BY cts.classifier_type_selector) FROM survey.classifiertypeselector cts WHERE cts.survey_fk = s.survey_pk) " +
+	"FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref"
+
+// exportFlushRows is how many rows are written between flushes, so the export reaches the client as it's read
+const exportFlushRows = 100
+
+var surveyExportColumns = []string{"id", "shortName", "longName", "surveyRef", "legalBasisRef", "legalBasis", "surveyType", "surveyMode", "status", "periodicity", "periodFormat", "archivedAt", "classifiers"}
+
+// exportSQL returns the statement and arguments for every survey matching the filters, in the requested order
+func (q *surveyListQuery) exportSQL() (string, []interface{}) {
+	column := surveySortColumns[q.sort]
+	direction := "ASC"
+	if q.descending {
+		direction = "DESC"
+	}
+	return surveyExportSelect + q.where(q.conditions) + " ORDER BY " + column + " " + direction + ", s.id " + direction, q.args
+}
+
+// packClassifiers packs classifiers into a single value in the form read by a CSV import
+func packClassifiers(classifiers []ClassifierTypeSelector) string {
+	selectors := make([]string, len(classifiers))
+	for i, c := range classifiers {
+		selectors[i] = c.Name + "=" + strings.Join(c.ClassifierTypes, "|")
+	}
+	return strings.Join(selectors, ";")
+}
+
+// surveyExportWriter writes surveys in one of the export formats
+type surveyExportWriter interface {
+	write(survey *Survey) error
+	flush() error
+}
+
+type csvSurveyExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvSurveyExportWriter) write(survey *Survey) error {
+	archivedAt := ""
+	if survey.ArchivedAt != nil {
+		archivedAt = survey.ArchivedAt.UTC().Format(time.RFC3339)
+	}
+	return e.w.Write([]string{survey.ID, survey.ShortName, survey.LongName, survey.Reference, survey.LegalBasisRef,
+		survey.LegalBasis, survey.SurveyType, survey.SurveyMode, survey.Status, stringValue(survey.Periodicity),
+		stringValue(survey.PeriodFormat), archivedAt, packClassifiers(survey.Classifiers)})
+}
+
+func (e *csvSurveyExportWriter) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonSurveyExportWriter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonSurveyExportWriter) write(survey *Survey) error {
+	return e.enc.Encode(survey)
+}
+
+func (e *ndjsonSurveyExportWriter) flush() error {
+	return nil
+}
+
+// ExportSurveys streams every survey matching the same filters as AllSurveys, with its classifiers, as CSV or as
+// newline delimited JSON depending on format. Rows are written as they're read from the database rather than being
+// gathered first, so the whole catalogue is never held in memory.
+func (api *API) ExportSurveys(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Exporting surveys", zap.String("url", r.URL.Path))
+	values := r.URL.Query()
+	format := values.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		http.Error(w, "format must be one of [csv, ndjson]", http.StatusBadRequest)
+		return
+	}
+
+	if values.Get("limit") != "" || values.Get("cursor") != "" {
+		http.Error(w, "An export can't be paged", http.StatusBadRequest)
+		return
+	}
+	q, err := parseSurveyListQuery(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query, args := q.exportSQL()
+	rows, err := api.DB.Query(query, args...)
+	if err != nil {
+		logErrorAndRespond(w, "Export surveys returned error", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	var export surveyExportWriter
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="surveys.csv"`)
+		csvWriter := csv.NewWriter(w)
+		csvWriter.Write(surveyExportColumns)
+		export = &csvSurveyExportWriter{w: csvWriter}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		export = &ndjsonSurveyExportWriter{enc: json.NewEncoder(w)}
+	}
+	flusher, _ := w.(http.Flusher)
+
+	// The status has been sent once the first row is written, so from here on errors can only be logged and the
+	// export cut short
+	count := 0
+	for rows.Next() {
+		survey, err := scanExportedSurvey(rows)
+		if err == nil {
+			err = export.write(survey)
+		}
+		if err != nil {
+			logError("Error exporting surveys", err)
+			return
+		}
+
+		count++
+		if count%exportFlushRows == 0 {
+			if err := export.flush(); err != nil {
+				logError("Error exporting surveys", err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		logError("Error exporting surveys", err)
+		return
+	}
+	if err := export.flush(); err != nil {
+		logError("Error exporting surveys", err)
+	}
+	logger.Info("Exported surveys", zap.String("format", format), zap.Int("surveys", count))
+}
+
+func scanExportedSurvey(rows *sql.Rows) (*Survey, error) {
+	survey := new(Survey)
+	var classifiers []byte
+	err := rows.Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis, &survey.ArchivedAt, &survey.Status, &survey.Periodicity, &survey.PeriodFormat, &classifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	survey.Classifiers = []ClassifierTypeSelector{}
+	if classifiers != nil {
+		if err := json.Unmarshal(classifiers, &survey.Classifiers); err != nil {
+			return nil, err
+		}
+	}
+	return survey, nil
+}
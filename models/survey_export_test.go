@@ -0,0 +1,141 @@
+package models_test
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var exportColumns = []string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "classifiers"}
+
+func TestExportSurveysCSV(t *testing.T) {
+	Convey("Survey export streams the filtered surveys as CSV with their classifiers", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows(exportColumns).
+			AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, "EQ", legalBasisLongName, nil, "LIVE", nil, nil, []byte(`[{"id": "`+classifierID+`", "name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE"]}, {"id": "a9b1d9e8-1c0c-4c8e-8a70-4f6d2e6a0c11", "name": "COMMUNICATION", "classifierTypes": ["REGION", "RU_REF"]}]`)).
+			AddRow("0b8d0f7c-0a25-4c3c-9d4b-2ad0d3c0f6a1", "OPN", "Opinions, Lifestyle Survey", "141", "STA1947", "Social", "EQ", legalBasisLongName, nil, "DESIGN", nil, nil, nil)
+		mock.ExpectQuery("SELECT id, s.short_name, .+, s.status, s.periodicity, s.period_format, \\(SELECT json_agg\\(.+\\) FROM survey.survey s .+ WHERE s.survey_mode = \\$1 AND s.archived_at IS NULL ORDER BY s.short_name ASC, s.id ASC").WithArgs("EQ").WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/export?format=csv&surveyMode=EQ"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("Content-Type"), ShouldStartWith, "text/csv")
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "id,shortName,longName,surveyRef,legalBasisRef,legalBasis,surveyType,surveyMode,status,periodicity,periodFormat,archivedAt,classifiers\n"+
+			surveyID+","+shortName+","+longName+","+reference+",STA1947,"+legalBasisLongName+",Business,EQ,LIVE,,,,COLLECTION_INSTRUMENT=FORM_TYPE;COMMUNICATION=REGION|RU_REF\n"+
+			"0b8d0f7c-0a25-4c3c-9d4b-2ad0d3c0f6a1,OPN,\"Opinions, Lifestyle Survey\",141,STA1947,"+legalBasisLongName+",Social,EQ,DESIGN,,,,\n")
+	})
+}
+
+func TestExportSurveysNDJSON(t *testing.T) {
+	Convey("Survey export streams surveys as newline delimited JSON", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows(exportColumns).
+			AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, "LIVE", nil, nil, []byte(`[{"id": "`+classifierID+`", "name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE"]}]`)).
+			AddRow("0b8d0f7c-0a25-4c3c-9d4b-2ad0d3c0f6a1", "OPN", "Opinions Survey", "141", "STA1947", "Social", "EQ", legalBasisLongName, nil, "LIVE", nil, nil, nil)
+		mock.ExpectQuery("SELECT id, s.short_name, .+ FROM survey.survey s .+ WHERE s.archived_at IS NULL ORDER BY s.survey_ref DESC, s.id DESC").WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/export?format=ndjson&sort=-surveyRef"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "application/x-ndjson")
+		var surveys []models.Survey
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			survey := models.Survey{}
+			So(json.Unmarshal(scanner.Bytes(), &survey), ShouldBeNil)
+			surveys = append(surveys, survey)
+		}
+		So(surveys, ShouldHaveLength, 2)
+		So(surveys[0].Classifiers, ShouldResemble, []models.ClassifierTypeSelector{{ID: classifierID, Name: "COLLECTION_INSTRUMENT", ClassifierTypes: []string{"FORM_TYPE"}}})
+		So(surveys[1].ShortName, ShouldEqual, "OPN")
+	})
+}
+
+func TestExportSurveysInvalidFormat(t *testing.T) {
+	Convey("Survey export returns a 400 for an unknown format", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/export?format=xlsx"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,280 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// Systems are named in upper case, e.g. IDBR, SDX or EQ, so they can be compared as they're stored
+var validExternalSystem = regexp.MustCompile(`^[A-Z][A-Z0-9_-]{0,19}$`)
+
+// ExternalID represents the identifier another system knows a survey by
+type ExternalID struct {
+	System     string `json:"system"`
+	Identifier string `json:"identifier"`
+}
+
+// externalSystem returns the system in the request path in the form it's stored, or writes a 400 response and
+// returns false if it isn't valid
+func externalSystem(w http.ResponseWriter, r *http.Request) (string, bool) {
+	system := strings.ToUpper(strings.TrimSpace(mux.Vars(r)["system"]))
+	if !validExternalSystem.MatchString(system) {
+		http.Error(w, "Systems must be 1 to 20 letters, digits, hyphens or underscores, starting with a letter", http.StatusBadRequest)
+		return "", false
+	}
+	return system, true
+}
+
+// readExternalIDs returns the external identifiers in rows
+func readExternalIDs(rows *sql.Rows) ([]ExternalID, error) {
+	defer rows.Close()
+
+	externalIDs := []ExternalID{}
+	for rows.Next() {
+		var externalID ExternalID
+		if err := rows.Scan(&externalID.System, &externalID.Identifier); err != nil {
+			return nil, err
+		}
+		externalIDs = append(externalIDs, externalID)
+	}
+	return externalIDs, rows.Err()
+}
+
+// AllSurveyExternalIDs endpoint handler - returns the identifiers other systems know the survey identified by
+// surveyId by
+func (api *API) AllSurveyExternalIDs(w http.ResponseWriter, r *http.Request) {
+	surveyID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	survey, err := api.getSurvey(surveyID)
+	if err == sql.ErrNoRows {
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logErrorAndRespond(w, "Error getting survey external identifiers", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := api.GetSurveyExternalIDsStmt.Query(surveyID)
+	if err != nil {
+		logErrorAndRespond(w, "Error getting survey external identifiers", http.StatusInternalServerError, err)
+		return
+	}
+
+	externalIDs, err := readExternalIDs(rows)
+	if err != nil {
+		logErrorAndRespond(w, "Error getting survey external identifiers", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", surveyETag(survey.Version))
+	if err := json.NewEncoder(w).Encode(externalIDs); err != nil {
+		logError("Error encoding response to 'get survey external identifiers'", err)
+	}
+}
+
+// PutSurveyExternalID endpoint handler - sets, or replaces, the identifier a system knows the survey identified by
+// surveyId by
+func (api *API) PutSurveyExternalID(w http.ResponseWriter, r *http.Request) {
+	surveyID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	system, ok := externalSystem(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading request body", http.StatusInternalServerError, err)
+		return
+	}
+
+	externalID := ExternalID{}
+	if err := json.Unmarshal(body, &externalID); err != nil {
+		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
+	}
+
+	externalID.System = system
+	externalID.Identifier = strings.TrimSpace(externalID.Identifier)
+	if externalID.Identifier == "" || len(externalID.Identifier) > 100 {
+		http.Error(w, "identifier: Value is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	api.changeSurveyExternalID(w, r, surveyID, system, &externalID)
+}
+
+// DeleteSurveyExternalID endpoint handler - removes the identifier a system knows the survey identified by surveyId by
+func (api *API) DeleteSurveyExternalID(w http.ResponseWriter, r *http.Request) {
+	surveyID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	system, ok := externalSystem(w, r)
+	if !ok {
+		return
+	}
+
+	api.changeSurveyExternalID(w, r, surveyID, system, nil)
+}
+
+// changeSurveyExternalID sets the identifier system knows a survey by, or removes it if externalID is nil, in a
+// transaction which locks the survey, checks it exists and matches If-Match, bumps its version and audits the change
+func (api *API) changeSurveyExternalID(w http.ResponseWriter, r *http.Request, surveyID, system string, externalID *ExternalID) {
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// The survey is locked so that concurrent changes to its identifiers are applied one after the other
+	before, err := api.getSurveyForUpdate(tx, surveyID)
+	if err == nil {
+		var rows *sql.Rows
+		if rows, err = tx.Stmt(api.GetSurveyExternalIDsStmt).Query(surveyID); err == nil {
+			before.ExternalIDs, err = readExternalIDs(rows)
+		}
+	}
+	if err == sql.ErrNoRows {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error getting survey external identifiers", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := api.checkIfMatch(tx, surveyID, r.Header.Get("If-Match")); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	after := *before
+	after.ExternalIDs = []ExternalID{}
+	for _, e := range before.ExternalIDs {
+		if e.System != system {
+			after.ExternalIDs = append(after.ExternalIDs, e)
+		}
+	}
+
+	operation := auditSetExternalID
+	actor := requestActor(r)
+	if externalID == nil {
+		if len(after.ExternalIDs) == len(before.ExternalIDs) {
+			rollBack(tx)
+			writeRestErrorResponse(w, "Survey external identifier not found", http.StatusNotFound)
+			return
+		}
+		operation = auditRemoveExternalID
+		_, err = tx.Stmt(api.DeleteSurveyExternalIDStmt).Exec(surveyID, system)
+	} else {
+		after.ExternalIDs = append(after.ExternalIDs, *externalID)
+		_, err = tx.Stmt(api.PutSurveyExternalIDStmt).Exec(surveyID, system, externalID.Identifier, actor)
+	}
+	if isUniqueViolation(err) {
+		rollBack(tx)
+		http.Error(w, "Identifier "+externalID.Identifier+" in "+system+" is already mapped to another survey", http.StatusConflict)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to change survey external identifier", http.StatusInternalServerError, err)
+		return
+	}
+
+	version, err := api.bumpSurveyVersion(tx, surveyID)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to update survey version", http.StatusInternalServerError, err)
+		return
+	}
+
+	after.Version = version
+	if err := api.writeAudit(tx, actor, surveyID, operation, before, &after); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey external identifier", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Survey external identifier changed", zap.String("survey_id", surveyID), zap.String("system", system), zap.String("operation", operation))
+	w.Header().Set("ETag", surveyETag(version))
+	if externalID == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(externalID); err != nil {
+		logError("Error encoding response to 'put survey external identifier'", err)
+	}
+}
+
+// GetSurveyByExternalID endpoint handler - returns the survey another system knows by identifier
+func (api *API) GetSurveyByExternalID(w http.ResponseWriter, r *http.Request) {
+	system, ok := externalSystem(w, r)
+	if !ok {
+		return
+	}
+	identifier := mux.Vars(r)["identifier"]
+	logger.Info("Resolving survey external identifier", zap.String("system", system), zap.String("identifier", identifier))
+
+	var surveyID string
+	err := api.GetSurveyIDByExternalIDStmt.QueryRow(system, identifier).Scan(&surveyID)
+
+	var survey *Survey
+	if err == nil {
+		survey, err = api.getSurvey(surveyID)
+	}
+	if err == sql.ErrNoRows {
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logErrorAndRespond(w, "get survey by external identifier query failed", http.StatusInternalServerError, err)
+		return
+	}
+
+	locale, ok := api.localiseSurveys(w, r, survey)
+	if !ok {
+		return
+	}
+
+	if writeNotModified(w, r, localisedSurveyETag(survey.Version, locale)) {
+		return
+	}
+
+	data, err := json.Marshal(survey)
+	if err != nil {
+		http.Error(w, "Failed to marshal survey JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,178 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetSurveyByExternalID(t *testing.T) {
+	Convey("External identifier GET resolves the identifier, matching the system ignoring case, to its survey", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectQuery("SELECT survey_id FROM survey.survey_external_id .+").WithArgs("IDBR", "221").WillReturnRows(sqlmock.NewRows([]string{"survey_id"}).AddRow(surveyID))
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, 2, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ WHERE id = ?").ExpectQuery().WithArgs(surveyID).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/external/idbr/221"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"2"`)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.ID, ShouldEqual, surveyID)
+		So(res.ShortName, ShouldEqual, shortName)
+	})
+}
+
+func TestGetSurveyByExternalIDNotFound(t *testing.T) {
+	Convey("External identifier GET returns a 404 if no survey has the identifier", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectQuery("SELECT survey_id FROM survey.survey_external_id .+").WithArgs("SDX", "999").WillReturnRows(sqlmock.NewRows([]string{"survey_id"}))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/external/SDX/999"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestPutSurveyExternalID(t *testing.T) {
+	Convey("External identifier PUT maps the system's identifier to the survey and returns it", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectBegin()
+		expectSurveyForUpdate(mock, sqlmock.NewRows(surveyForUpdateColumns).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, 3, "LIVE", nil, nil, nil, "{}", nil))
+		mock.ExpectPrepare("SELECT system, identifier FROM survey.survey_external_id .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"system", "identifier"}).AddRow("SDX", "221"))
+		mock.ExpectPrepare("INSERT INTO survey.survey_external_id .+").ExpectExec().WithArgs(surveyID, "IDBR", "221", "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "SET_EXTERNAL_ID", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/externalids/idbr"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("PUT", url, strings.NewReader(`{"identifier": " 221 "}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"4"`)
+		res := models.ExternalID{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res, ShouldResemble, models.ExternalID{System: "IDBR", Identifier: "221"})
+	})
+}
+
+func TestPutSurveyExternalIDConflict(t *testing.T) {
+	Convey("External identifier PUT returns a 409 if the identifier is mapped to another survey", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectBegin()
+		expectSurveyForUpdate(mock, sqlmock.NewRows(surveyForUpdateColumns).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, 3, "LIVE", nil, nil, nil, "{}", nil))
+		mock.ExpectPrepare("SELECT system, identifier FROM survey.survey_external_id .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"system", "identifier"}))
+		mock.ExpectPrepare("INSERT INTO survey.survey_external_id .+").ExpectExec().WithArgs(surveyID, "EQ", "bres_0001", "unknown").WillReturnError(&pq.Error{Code: "23505"})
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/externalids/EQ"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("PUT", url, strings.NewReader(`{"identifier": "bres_0001"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldContainSubstring, "already mapped to another survey")
+	})
+}
@@ -0,0 +1,316 @@
+package models
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	importAllOrNothing = "all-or-nothing"
+	importBestEffort   = "best-effort"
+	maxImportRows      = 1000
+
+	importCreated    = "CREATED"
+	importInvalid    = "INVALID"
+	importNotCreated = "NOT_CREATED"
+	importFailed     = "FAILED"
+)
+
+// importColumns are the columns a CSV import may have, keyed on the lower case header
+var importColumns = map[string]func(*Survey, string){
+	"id":            func(s *Survey, v string) { s.ID = v },
+	"shortname":     func(s *Survey, v string) { s.ShortName = v },
+	"longname":      func(s *Survey, v string) { s.LongName = v },
+	"surveyref":     func(s *Survey, v string) { s.Reference = v },
+	"legalbasis":    func(s *Survey, v string) { s.LegalBasis = v },
+	"legalbasisref": func(s *Survey, v string) { s.LegalBasisRef = v },
+	"surveytype":    func(s *Survey, v string) { s.SurveyType = v },
+	"surveymode":    func(s *Survey, v string) { s.SurveyMode = v },
+	"periodicity":   func(s *Survey, v string) { s.Periodicity = optionalString(v) },
+	"periodformat":  func(s *Survey, v string) { s.PeriodFormat = optionalString(v) },
+	"classifiers":   func(s *Survey, v string) { s.Classifiers = parsePackedClassifiers(v) },
+}
+
+// SurveyImportResult is the outcome of importing one survey. Row counts from 1 for the first survey, whichever
+// format the import is in.
+type SurveyImportResult struct {
+	Row       int          `json:"row"`
+	ID        string       `json:"id,omitempty"`
+	ShortName string       `json:"shortName"`
+	Status    string       `json:"status"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// SurveyImportReport is the outcome of importing a batch of surveys
+type SurveyImportReport struct {
+	Mode    string               `json:"mode"`
+	Created int                  `json:"created"`
+	Results []SurveyImportResult `json:"results"`
+}
+
+// parsePackedClassifiers parses the classifiers column of a CSV import, where classifier type selectors are
+// separated by semicolons and each is a name, an equals sign and its classifier types separated by pipes,
+// e.g. COLLECTION_INSTRUMENT=FORM_TYPE;COMMUNICATION=RU_REF|REGION
+func parsePackedClassifiers(packed string) []ClassifierTypeSelector {
+	classifiers := []ClassifierTypeSelector{}
+	for _, selector := range strings.Split(packed, ";") {
+		if strings.TrimSpace(selector) == "" {
+			continue
+		}
+		classifier := ClassifierTypeSelector{ClassifierTypes: []string{}}
+		name, types, _ := strings.Cut(selector, "=")
+		classifier.Name = strings.TrimSpace(name)
+		for _, classifierType := range strings.Split(types, "|") {
+			if classifierType = strings.TrimSpace(classifierType); classifierType != "" {
+				classifier.ClassifierTypes = append(classifier.ClassifierTypes, classifierType)
+			}
+		}
+		classifiers = append(classifiers, classifier)
+	}
+	return classifiers
+}
+
+// readImportCSV reads surveys from CSV with a header row naming the columns
+func readImportCSV(body io.Reader) ([]Survey, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading CSV - %v", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV must have a header row")
+	}
+
+	setters := make([]func(*Survey, string), len(records[0]))
+	for i, column := range records[0] {
+		setter, ok := importColumns[strings.ToLower(strings.TrimSpace(column))]
+		if !ok {
+			return nil, fmt.Errorf("Unknown CSV column %v", column)
+		}
+		setters[i] = setter
+	}
+
+	surveys := []Survey{}
+	for _, record := range records[1:] {
+		var survey Survey
+		for i, value := range record {
+			setters[i](&survey, strings.TrimSpace(value))
+		}
+		surveys = append(surveys, survey)
+	}
+	return surveys, nil
+}
+
+// ImportSurveys endpoint handler - creates a batch of surveys from a JSON array, or from CSV if the content type is
+// text/csv. In all-or-nothing mode, the default, either every survey is created or none are. In best-effort mode
+// each valid survey is created on its own.
+func (api *API) ImportSurveys(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = importAllOrNothing
+	}
+	if mode != importAllOrNothing && mode != importBestEffort {
+		http.Error(w, "mode must be one of ["+importAllOrNothing+", "+importBestEffort+"]", http.StatusBadRequest)
+		return
+	}
+
+	var surveys []Survey
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+		surveys, err = readImportCSV(r.Body)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&surveys)
+		if err != nil {
+			err = fmt.Errorf("Error unmarshalling JSON")
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(surveys) == 0 {
+		http.Error(w, "No surveys to import", http.StatusBadRequest)
+		return
+	}
+	if len(surveys) > maxImportRows {
+		http.Error(w, fmt.Sprintf("At most %d surveys can be imported at once", maxImportRows), http.StatusBadRequest)
+		return
+	}
+
+	report := SurveyImportReport{Mode: mode, Results: make([]SurveyImportResult, len(surveys))}
+	valid, err := api.checkImport(surveys, report.Results)
+	if err != nil {
+		logErrorAndRespond(w, "Error validating surveys to import", http.StatusInternalServerError, err)
+		return
+	}
+
+	status := http.StatusOK
+	actor := requestActor(r)
+	if mode == importAllOrNothing {
+		if !valid {
+			status = http.StatusBadRequest
+		} else if err := api.importAll(surveys, report.Results, actor); isUniqueViolation(err) {
+			http.Error(w, "A survey with the same id, short name or reference, or a classifier type selector with the same id, already exists", http.StatusConflict)
+			return
+		} else if err != nil {
+			logErrorAndRespond(w, "Error importing surveys", http.StatusInternalServerError, err)
+			return
+		} else {
+			status = http.StatusCreated
+		}
+	} else {
+		api.importEach(surveys, report.Results, actor)
+	}
+
+	for _, result := range report.Results {
+		if result.Status == importCreated {
+			report.Created++
+		}
+	}
+	logger.Info("Imported surveys", zap.String("mode", mode), zap.Int("surveys", len(surveys)), zap.Int("created", report.Created))
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logError("Error encoding response to 'import surveys'", err)
+	}
+}
+
+// checkImport validates every survey in an import, recording the problems with each in its result, and fills in
+// the survey's id and legal basis ready for it to be created. As well as the checks made on a single survey, no two
+// surveys in the import may share an id, short name, reference or classifier type selector id. Returns true if
+// every survey is valid.
+func (api *API) checkImport(surveys []Survey, results []SurveyImportResult) (bool, error) {
+	seen := map[string]int{}
+	duplicate := func(field, value string, row int) *FieldError {
+		key := field + ":" + strings.ToLower(value)
+		if first, ok := seen[key]; ok && value != "" {
+			return &FieldError{Field: field, Message: fmt.Sprintf("Value %v is also used by row %d", value, first)}
+		}
+		seen[key] = row
+		return nil
+	}
+
+	valid := true
+	for i := range surveys {
+		survey := &surveys[i]
+		row := i + 1
+		legalBasis, problems, err := api.checkSurvey(survey, "")
+		if err != nil {
+			return false, err
+		}
+		fieldErrors := problems.fieldErrors()
+
+		for _, fe := range []*FieldError{
+			duplicate("id", survey.ID, row),
+			duplicate("shortName", survey.ShortName, row),
+			duplicate("surveyRef", survey.Reference, row),
+		} {
+			if fe != nil {
+				fieldErrors = append(fieldErrors, *fe)
+			}
+		}
+		for j, c := range survey.Classifiers {
+			if fe := duplicate("classifierTypeSelectorId", c.ID, row); fe != nil {
+				fieldErrors = append(fieldErrors, FieldError{Field: fmt.Sprintf("classifiers[%d]", j), Message: fe.Message})
+			}
+		}
+
+		results[i] = SurveyImportResult{Row: row, ID: survey.ID, ShortName: survey.ShortName, Status: importNotCreated}
+		if len(fieldErrors) > 0 {
+			results[i].Status = importInvalid
+			results[i].Errors = fieldErrors
+			valid = false
+			continue
+		}
+
+		if survey.ID == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return false, err
+			}
+			survey.ID = id.String()
+		}
+		survey.ArchivedAt = nil
+		survey.LegalBasisRef = legalBasis.Reference
+		survey.LegalBasis = legalBasis.LongName
+	}
+	return valid, nil
+}
+
+// importAll creates every survey in one transaction
+func (api *API) importAll(surveys []Survey, results []SurveyImportResult, actor string) error {
+	tx, err := api.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	for i := range surveys {
+		if _, err := api.insertSurvey(tx, &surveys[i], actor); err != nil {
+			rollBack(tx)
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		return err
+	}
+
+	for i := range surveys {
+		results[i].ID = surveys[i].ID
+		results[i].Status = importCreated
+	}
+	return nil
+}
+
+// importEach creates each valid survey in a transaction of its own, so one which fails doesn't stop the rest
+func (api *API) importEach(surveys []Survey, results []SurveyImportResult, actor string) {
+	for i := range surveys {
+		if results[i].Status == importInvalid {
+			continue
+		}
+
+		if err := api.importOne(&surveys[i], actor); err != nil {
+			logError("Error importing survey", err)
+			results[i].Status = importFailed
+			message := "Create survey failed"
+			if isUniqueViolation(err) {
+				message = "A survey with the same id, short name or reference, or a classifier type selector with the same id, already exists"
+			}
+			results[i].Errors = []FieldError{{Message: message}}
+			continue
+		}
+
+		results[i].ID = surveys[i].ID
+		results[i].Status = importCreated
+	}
+}
+
+func (api *API) importOne(survey *Survey, actor string) error {
+	tx, err := api.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := api.insertSurvey(tx, survey, actor); err != nil {
+		rollBack(tx)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		return err
+	}
+	return nil
+}
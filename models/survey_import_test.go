@@ -0,0 +1,177 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestImportSurveysAllOrNothingInvalid(t *testing.T) {
+	Convey("Survey import creates nothing if any survey is invalid in all-or-nothing mode", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		for _, ref := range []string{"101", "102"} {
+			mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+			mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+			mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(ref).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		}
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/import"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `[
+			{"shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "101", "legalBasisRef": "STA1947", "surveyType": "Social", "surveyMode": "SEFT"},
+			{"shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "102", "legalBasisRef": "STA1947", "surveyType": "Invalid", "surveyMode": "SEFT"}
+		]`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		res := models.SurveyImportReport{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Mode, ShouldEqual, "all-or-nothing")
+		So(res.Created, ShouldEqual, 0)
+		So(res.Results[0].Status, ShouldEqual, "NOT_CREATED")
+		So(res.Results[1].Status, ShouldEqual, "INVALID")
+		So(res.Results[1].Errors, ShouldResemble, []models.FieldError{
+			{Field: "surveyType", Message: "Survey type must be one of [Census, Business, Social]"},
+			{Field: "shortName", Message: "Value " + shortName + " is also used by row 1"},
+		})
+	})
+}
+
+func TestImportSurveysCSVBestEffort(t *testing.T) {
+	Convey("Survey import creates each valid survey from CSV in best-effort mode", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs("LMS").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs("201").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("NOPE").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs("OPN").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs("202").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectBegin()
+		mock.ExpectPrepare("INSERT INTO survey.survey .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), "201", "LMS", "Labour Market Survey", "STA1947", "Social", "EQ", nil, nil, "{}").WillReturnRows(sqlmock.NewRows([]string{"survey_pk", "version", "status"}).AddRow(1000, 1, "DESIGN"))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(sqlmock.AnyArg(), "unknown", "CREATE_SURVEY", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertypeselector .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), 1000, "COLLECTION_INSTRUMENT").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertype .+").ExpectExec().WithArgs(1, "FORM_TYPE").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(sqlmock.AnyArg(), "unknown", "CREATE_CLASSIFIER", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertypeselector .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), 1000, "COMMUNICATION").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertype .+").ExpectExec().WithArgs(2, "RU_REF").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertype .+").ExpectExec().WithArgs(2, "REGION").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(sqlmock.AnyArg(), "unknown", "CREATE_CLASSIFIER", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/import?mode=best-effort"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := "shortName,longName,surveyRef,legalBasisRef,surveyType,surveyMode,classifiers\n" +
+			"LMS,Labour Market Survey,201,STA1947,Social,EQ,COLLECTION_INSTRUMENT=FORM_TYPE;COMMUNICATION=RU_REF|REGION\n" +
+			"OPN,Opinions Survey,202,NOPE,Social,EQ,\n"
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "text/csv")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.SurveyImportReport{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Created, ShouldEqual, 1)
+		So(res.Results[0].Status, ShouldEqual, "CREATED")
+		So(res.Results[0].ID, ShouldNotBeEmpty)
+		So(res.Results[1].Status, ShouldEqual, "INVALID")
+		So(res.Results[1].Errors, ShouldResemble, []models.FieldError{
+			{Field: "legalBasisRef", Message: "Legal basis with reference NOPE does not exist"},
+		})
+	})
+}
+
+func TestImportSurveysUnknownCSVColumn(t *testing.T) {
+	Convey("Survey import returns a 400 for a CSV column it doesn't know", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/import"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader("shortName,colour\nLMS,blue\n"))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "text/csv; charset=utf-8")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, "Unknown CSV column colour")
+	})
+}
@@ -0,0 +1,292 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	surveyListSelect = "SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.status, s.periodicity, s.period_format, s.attributes, ARRAY(SELECT t.tag FROM survey.survey_tag t WHERE t.survey_id = s.id ORDER BY t.tag), (SELECT json_build_object('division', o.division, 'teamMailbox', o.team_mailbox, 'helpline', o.helpline, 'escalationContacts', o.escalation_contacts) FROM survey.survey_owner o WHERE o.survey_id = s.id) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref"
+	surveyListCount  = "SELECT COUNT(*) FROM survey.survey s"
+
+	defaultSurveySort = "shortName"
+	maxSurveyPageSize = 500
+)
+
+// surveySortColumns maps the sortable JSON field names of a Survey onto the columns used to order them
+var surveySortColumns = map[string]string{
+	"shortName":     "s.short_name",
+	"longName":      "s.long_name",
+	"surveyRef":     "s.survey_ref",
+	"surveyType":    "s.survey_type",
+	"surveyMode":    "s.survey_mode",
+	"legalBasisRef": "s.legal_basis",
+}
+
+var validSurveyModes = map[string]bool{"EQ": true, "SEFT": true, "EQ_AND_SEFT": true}
+
+// surveyCursor identifies the last survey on a page so the next page can carry on after it
+type surveyCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// surveyListQuery holds the filters, ordering and page requested by a caller of GET /surveys
+type surveyListQuery struct {
+	conditions []string
+	args       []interface{}
+	sort       string
+	descending bool
+	limit      int
+	cursor     *surveyCursor
+}
+
+// parseSurveyListQuery builds a surveyListQuery from the request's query string, returning an error describing
+// the first invalid parameter
+func parseSurveyListQuery(values url.Values) (*surveyListQuery, error) {
+	q := &surveyListQuery{sort: defaultSurveySort}
+
+	if v := values.Get("surveyType"); v != "" {
+		surveyType, ok := surveyTypes[strings.ToLower(v)]
+		if !ok {
+			return nil, errors.New("surveyType must be one of [Census, Business, Social]")
+		}
+		q.addCondition("s.survey_type = $%d", surveyType)
+	}
+
+	if v := values.Get("surveyMode"); v != "" {
+		if !validSurveyModes[v] {
+			return nil, errors.New("surveyMode must be one of [EQ, SEFT, EQ_AND_SEFT]")
+		}
+		q.addCondition("s.survey_mode = $%d", v)
+	}
+
+	if v := values.Get("legalBasisRef"); v != "" {
+		q.addCondition("s.legal_basis = $%d", v)
+	}
+
+	if v := values.Get("status"); v != "" {
+		statuses, err := parseSurveyStatuses(v)
+		if err != nil {
+			return nil, err
+		}
+		q.addCondition("s.status::text = ANY($%d)", pq.Array(statuses))
+	}
+
+	if v := values["tag"]; len(v) > 0 {
+		tags, err := parseTags(v)
+		if err != nil {
+			return nil, err
+		}
+		switch values.Get("tagMatch") {
+		case "", tagMatchAll:
+			q.addCondition("(SELECT COUNT(*) FROM survey.survey_tag t WHERE t.survey_id = s.id AND t.tag = ANY($%[1]d::text[])) = cardinality($%[1]d::text[])", pq.Array(tags))
+		case tagMatchAny:
+			q.addCondition("EXISTS (SELECT 1 FROM survey.survey_tag t WHERE t.survey_id = s.id AND t.tag = ANY($%d))", pq.Array(tags))
+		default:
+			return nil, errors.New("tagMatch must be one of [all, any]")
+		}
+	}
+
+	if err := q.parseAttributeFilters(values); err != nil {
+		return nil, err
+	}
+
+	includeArchived := false
+	if v := values.Get("includeArchived"); v != "" {
+		var err error
+		if includeArchived, err = strconv.ParseBool(v); err != nil {
+			return nil, errors.New("includeArchived must be true or false")
+		}
+	}
+	if !includeArchived {
+		q.conditions = append(q.conditions, "s.archived_at IS NULL")
+	}
+
+	if v := values.Get("sort"); v != "" {
+		q.descending = strings.HasPrefix(v, "-")
+		q.sort = strings.TrimPrefix(v, "-")
+		if _, ok := surveySortColumns[q.sort]; !ok {
+			return nil, errors.Errorf("Cannot sort surveys by '%s'", q.sort)
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSurveyPageSize {
+			return nil, errors.Errorf("limit must be a number between 1 and %d", maxSurveyPageSize)
+		}
+		q.limit = limit
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		cursor, err := decodeSurveyCursor(v)
+		if err != nil || cursor.Sort != values.Get("sort") {
+			return nil, errors.New("cursor is not valid for this query")
+		}
+		q.cursor = cursor
+	}
+
+	return q, nil
+}
+
+func (q *surveyListQuery) addCondition(format string, arg interface{}) {
+	q.args = append(q.args, arg)
+	q.conditions = append(q.conditions, fmt.Sprintf(format, len(q.args)))
+}
+
+func (q *surveyListQuery) where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// pageSQL returns the statement and arguments for one page of surveys. One more row than the limit is requested
+// so we can tell whether there is a further page.
+func (q *surveyListQuery) pageSQL() (string, []interface{}) {
+	column := surveySortColumns[q.sort]
+	direction, comparison := "ASC", ">"
+	if q.descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	conditions := q.conditions
+	args := q.args
+	if q.cursor != nil {
+		args = append(append([]interface{}{}, args...), q.cursor.Value, q.cursor.ID)
+		conditions = append(append([]string{}, conditions...),
+			fmt.Sprintf("(%s, s.id) %s ($%d, $%d)", column, comparison, len(args)-1, len(args)))
+	}
+
+	query := surveyListSelect + q.where(conditions) + fmt.Sprintf(" ORDER BY %s %s, s.id %s", column, direction, direction)
+	if q.limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.limit+1)
+	}
+	return query, args
+}
+
+// countSQL returns the statement and arguments to count every survey matching the filters, ignoring the page
+func (q *surveyListQuery) countSQL() (string, []interface{}) {
+	return surveyListCount + q.where(q.conditions), q.args
+}
+
+// sortValue returns the value of the survey field the query is ordered by
+func (q *surveyListQuery) sortValue(survey *Survey) string {
+	switch q.sort {
+	case "longName":
+		return survey.LongName
+	case "surveyRef":
+		return survey.Reference
+	case "surveyType":
+		return survey.SurveyType
+	case "surveyMode":
+		return survey.SurveyMode
+	case "legalBasisRef":
+		return survey.LegalBasisRef
+	default:
+		return survey.ShortName
+	}
+}
+
+func encodeSurveyCursor(cursor surveyCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSurveyCursor(value string) (*surveyCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	cursor := new(surveyCursor)
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// AllSurveys returns a list of known surveys, optionally filtered by surveyType, surveyMode, legalBasisRef, status, tag and attributes,
+// ordered by sort and paged using limit and cursor. Archived surveys are left out unless includeArchived is true. The total number of matching surveys is returned in the
+// X-Total-Count header and the next page, if there is one, in a Link header.
+func (api *API) AllSurveys(w http.ResponseWriter, r *http.Request) {
+	logger.Info("Getting AllSurveys", zap.String("url", r.URL.Path))
+	q, err := parseSurveyListQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query, args := q.pageSQL()
+	rows, err := api.DB.Query(query, args...)
+	if err != nil {
+		logError("Get all surveys returned error", err)
+		http.Error(w, "Failed to retrieve surveys", http.StatusInternalServerError)
+		return
+	}
+
+	surveys, err := scanSurveys(rows)
+	if err != nil {
+		logError("Failed to get surveys from database", err)
+		http.Error(w, "Failed to get surveys from database", http.StatusInternalServerError)
+		return
+	}
+
+	hasNextPage := q.limit > 0 && len(surveys) > q.limit
+	if hasNextPage {
+		surveys = surveys[:q.limit]
+	}
+
+	// A complete first page already tells us the total, so only count when the results have been paged
+	total := len(surveys)
+	if hasNextPage || q.cursor != nil {
+		countQuery, countArgs := q.countSQL()
+		if err := api.DB.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+			logError("Count surveys returned error", err)
+			http.Error(w, "Failed to retrieve surveys", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if hasNextPage {
+		last := surveys[len(surveys)-1]
+		next := r.URL.Query()
+		next.Set("cursor", encodeSurveyCursor(surveyCursor{Sort: r.URL.Query().Get("sort"), Value: q.sortValue(last), ID: last.ID}))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+
+	if _, ok := api.localiseSurveys(w, r, surveys...); !ok {
+		return
+	}
+
+	writeSurveys(w, surveys)
+}
+
+func scanSurveys(rows *sql.Rows) ([]*Survey, error) {
+	defer rows.Close()
+	surveys := make([]*Survey, 0)
+
+	for rows.Next() {
+		survey := new(Survey)
+		err := rows.Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis, &survey.ArchivedAt, &survey.Status, &survey.Periodicity, &survey.PeriodFormat, &survey.Attributes, pq.Array(&survey.Tags), ownerColumn{&survey.Owner})
+		if err != nil {
+			return nil, err
+		}
+
+		surveys = append(surveys, survey)
+	}
+
+	return surveys, rows.Err()
+}
@@ -0,0 +1,233 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSurveyListFilteredSortedAndPaged(t *testing.T) {
+	Convey("Surveys list applies filters, sort and limit and links to the next page", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).
+			AddRow(surveyID, shortName, longName, "300", "STA1947", surveyType, "EQ", legalBasisLongName, nil, "LIVE", nil, nil, nil, nil, nil).
+			AddRow(classifierID, "other-shortname", longName, "200", "STA1947", surveyType, "EQ", legalBasisLongName, nil, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectQuery("SELECT id, s.short_name, .+ WHERE s.survey_type = \\$1 AND s.survey_mode = \\$2 AND s.legal_basis = \\$3 AND s.archived_at IS NULL ORDER BY s.survey_ref DESC, s.id DESC LIMIT 2").
+			WithArgs("Business", "EQ", "STA1947").WillReturnRows(rows)
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM survey.survey s WHERE s.survey_type = \\$1 AND s.survey_mode = \\$2 AND s.legal_basis = \\$3 AND s.archived_at IS NULL").
+			WithArgs("Business", "EQ", "STA1947").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys?surveyType=business&surveyMode=EQ&legalBasisRef=STA1947&sort=-surveyRef&limit=1"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("X-Total-Count"), ShouldEqual, "7")
+		So(resp.Header.Get("Link"), ShouldStartWith, "</surveys?cursor=")
+		So(resp.Header.Get("Link"), ShouldEndWith, `>; rel="next"`)
+		res := []models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		json.Unmarshal(body, &res)
+		So(res, ShouldHaveLength, 1)
+		So(res[0].ID, ShouldEqual, surveyID)
+	})
+}
+
+func TestSurveyListLastPageHasNoNextLink(t *testing.T) {
+	Convey("Surveys list without further results omits the next link", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).
+			AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectQuery("SELECT id, s.short_name, .+ WHERE s.archived_at IS NULL ORDER BY s.short_name ASC, s.id ASC LIMIT 11").WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys?limit=10"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("X-Total-Count"), ShouldEqual, "1")
+		So(resp.Header.Get("Link"), ShouldBeEmpty)
+	})
+}
+
+func TestSurveyListIncludesArchived(t *testing.T) {
+	Convey("Surveys list includes archived surveys when asked to", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		archivedAt := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).
+			AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, archivedAt, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectQuery("SELECT id, s.short_name, .+ FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref ORDER BY s.short_name ASC, s.id ASC").WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys?includeArchived=true"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := []models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res, ShouldHaveLength, 1)
+		So(res[0].ArchivedAt, ShouldNotBeNil)
+		So(res[0].ArchivedAt.Equal(archivedAt), ShouldBeTrue)
+	})
+}
+
+func TestSurveyListFilteredByStatus(t *testing.T) {
+	Convey("Surveys list only includes surveys with one of the given statuses", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).
+			AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, "SUSPENDED", nil, nil, nil, nil, nil)
+		mock.ExpectQuery("SELECT id, s.short_name, .+ WHERE s.status::text = ANY\\(\\$1\\) AND s.archived_at IS NULL ORDER BY s.short_name ASC, s.id ASC").
+			WithArgs(`{"LIVE","SUSPENDED"}`).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys?status=live,SUSPENDED"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := []models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res, ShouldHaveLength, 1)
+		So(res[0].Status, ShouldEqual, "SUSPENDED")
+	})
+}
+
+func TestSurveyListInvalidParameters(t *testing.T) {
+	Convey("Surveys list rejects invalid query parameters", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+
+		for query, message := range map[string]string{
+			"sort=id":             "Cannot sort surveys by 'id'",
+			"limit=0":             "limit must be a number between 1 and 500",
+			"surveyType=Unknown":  "surveyType must be one of [Census, Business, Social]",
+			"surveyMode=PAPER":    "surveyMode must be one of [EQ, SEFT, EQ_AND_SEFT]",
+			"cursor=not-a-cursor": "cursor is not valid for this query",
+			"includeArchived=yes": "includeArchived must be true or false",
+			"status=ACTIVE":       "status must be one of [DESIGN, LIVE, SUSPENDED, RETIRED]",
+		} {
+			r, err := http.NewRequest("GET", ts.URL+"/surveys?"+query, nil)
+			So(err, ShouldBeNil)
+			r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+			resp, err := httpClient.Do(r)
+			So(err, ShouldBeNil)
+
+			// Then
+			So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+			body, _ := io.ReadAll(resp.Body)
+			So(string(body), ShouldStartWith, message)
+		}
+	})
+}
@@ -0,0 +1,414 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// The ways a merge can resolve a classifier type selector name used by both surveys
+const (
+	mergeFail       = "fail"
+	mergeKeepTarget = "keep-target"
+	mergeKeepSource = "keep-source"
+	mergeCombine    = "combine"
+)
+
+var validMergeStrategies = map[string]bool{mergeFail: true, mergeKeepTarget: true, mergeKeepSource: true, mergeCombine: true}
+
+// SurveyMerge identifies the survey to merge into another and how to resolve clashing classifier type selectors
+type SurveyMerge struct {
+	SourceID string `json:"sourceId"`
+	Strategy string `json:"strategy"`
+}
+
+// MergeSurvey endpoint handler - moves the classifier type selectors of the source survey onto the survey identified
+// by surveyId, keeps the source's short name and reference as aliases of it and archives the source
+func (api *API) MergeSurvey(w http.ResponseWriter, r *http.Request) {
+	targetID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(targetID); err != nil {
+		http.Error(w, "The value ("+targetID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading request body", http.StatusInternalServerError, err)
+		return
+	}
+	var merge SurveyMerge
+	if err := json.Unmarshal(body, &merge); err != nil {
+		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
+	}
+	if _, err := uuid.FromString(merge.SourceID); err != nil {
+		http.Error(w, "The value ("+merge.SourceID+") used for sourceId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+	if strings.EqualFold(merge.SourceID, targetID) {
+		http.Error(w, "A survey can't be merged into itself", http.StatusBadRequest)
+		return
+	}
+	if merge.Strategy == "" {
+		merge.Strategy = mergeFail
+	}
+	if !validMergeStrategies[merge.Strategy] {
+		http.Error(w, "strategy must be one of [fail, keep-target, keep-source, combine]", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// Both surveys are locked, in id order so that two merges of the same surveys can't deadlock
+	if err := api.lockSurveys(tx, targetID, merge.SourceID); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error locking surveys to merge", http.StatusInternalServerError, err)
+		return
+	}
+
+	target, err := api.getMergeSnapshot(tx, targetID)
+	if err == sql.ErrNoRows || (err == nil && target.ArchivedAt != nil) {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error getting survey to merge into", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := api.checkIfMatch(tx, targetID, r.Header.Get("If-Match")); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	source, err := api.getMergeSnapshot(tx, merge.SourceID)
+	if err == sql.ErrNoRows || (err == nil && source.ArchivedAt != nil) {
+		rollBack(tx)
+		http.Error(w, "Source survey "+merge.SourceID+" not found", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error getting survey to merge", http.StatusInternalServerError, err)
+		return
+	}
+
+	targetClassifiers := map[string]ClassifierTypeSelector{}
+	for _, c := range target.Classifiers {
+		targetClassifiers[c.Name] = c
+	}
+	if merge.Strategy == mergeFail {
+		if clashes := mergeClashes(source, target, targetClassifiers); len(clashes) > 0 {
+			rollBack(tx)
+			http.Error(w, strings.Join(clashes, "; "), http.StatusConflict)
+			return
+		}
+	}
+
+	if reqErr := api.mergeClassifiers(tx, targetID, source.Classifiers, targetClassifiers, merge.Strategy); reqErr != nil {
+		rollBack(tx)
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+
+	// The source's tags, external identifiers and translations move onto the target too, so the source's external
+	// identifiers still find a survey once it's archived
+	actor := requestActor(r)
+	if reqErr := api.mergeSurveyDetails(tx, source, target, merge.Strategy, actor); reqErr != nil {
+		rollBack(tx)
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+
+	// The source's names, and any it was known by before, now find the target
+	if _, err := tx.Stmt(api.MoveSurveyAliasesStmt).Exec(source.ID, targetID); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to move survey aliases", http.StatusInternalServerError, err)
+		return
+	}
+	for _, alias := range []struct{ kind, name string }{{aliasShortName, source.ShortName}, {aliasRef, source.Reference}} {
+		_, err := tx.Stmt(api.CreateSurveyAliasStmt).Exec(targetID, alias.kind, alias.name, actor)
+		if isUniqueViolation(err) {
+			rollBack(tx)
+			http.Error(w, alias.name+" is already an alias of another survey", http.StatusConflict)
+			return
+		} else if err != nil {
+			rollBack(tx)
+			logErrorAndRespond(w, "Failed to record survey alias", http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	archived, err := api.getMergeSnapshot(tx, source.ID)
+	if err == nil {
+		err = tx.Stmt(api.ArchiveSurveyStmt).QueryRow(source.ID).Scan(&archived.ArchivedAt)
+	}
+	if err == nil {
+		archived.Version, err = api.bumpSurveyVersion(tx, source.ID)
+	}
+	if err == nil {
+		err = api.writeAudit(tx, actor, source.ID, auditMergeSurvey, source, archived)
+	}
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to archive merged survey", http.StatusInternalServerError, err)
+		return
+	}
+
+	version, err := api.bumpSurveyVersion(tx, targetID)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to update survey version", http.StatusInternalServerError, err)
+		return
+	}
+	merged, err := api.getMergeSnapshot(tx, targetID)
+	if err == nil {
+		err = api.writeAudit(tx, actor, targetID, auditMergeSurvey, target, merged)
+	}
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey merge", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Survey merged", zap.String("source_survey_id", source.ID), zap.String("survey_id", targetID), zap.String("strategy", merge.Strategy))
+	// The survey is returned in the same format as GET /surveys/{surveyId}, with its classifiers
+	merged.Version = version
+	merged.Translations = nil
+	merged.ExternalIDs = nil
+	writeSurvey(w, merged)
+}
+
+// lockSurveys locks the surveys with the given ids for the rest of transaction tx, in id order so that transactions
+// locking the same surveys can't deadlock. A survey which doesn't exist has nothing to lock, and is left for the
+// caller to find when it reads it.
+func (api *API) lockSurveys(tx *sql.Tx, ids ...string) error {
+	ordered := make([]string, len(ids))
+	for i, id := range ids {
+		ordered[i] = strings.ToLower(id)
+	}
+	sort.Strings(ordered)
+
+	for _, id := range ordered {
+		var version int
+		if err := tx.Stmt(api.LockSurveyVersionStmt).QueryRow(id).Scan(&version); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return nil
+}
+
+// getMergeSnapshot returns the survey with the given id as getSurveySnapshot does, adding the tags, owner, external
+// identifiers and translations of a survey which isn't archived, as a merge changes those too
+func (api *API) getMergeSnapshot(tx *sql.Tx, surveyID string) (*Survey, error) {
+	survey, err := api.getSurveySnapshot(tx, surveyID)
+	if err != nil || survey.ArchivedAt != nil {
+		return survey, err
+	}
+
+	current, err := api.getSurveyInTx(tx, surveyID)
+	if err != nil {
+		return nil, err
+	}
+	survey.Tags = current.Tags
+	survey.Owner = current.Owner
+
+	rows, err := tx.Stmt(api.GetSurveyExternalIDsStmt).Query(surveyID)
+	if err != nil {
+		return nil, err
+	}
+	if survey.ExternalIDs, err = readExternalIDs(rows); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Stmt(api.GetSurveyTranslationsStmt).Query(pq.Array([]string{surveyID}))
+	if err != nil {
+		return nil, err
+	}
+	translations, err := readTranslations(rows)
+	if err != nil {
+		return nil, err
+	}
+	survey.Translations = translations[surveyID]
+	return survey, nil
+}
+
+// mergeClashes describes what both surveys have which the fail strategy refuses to merge: classifier type selectors
+// with the same name, identifiers in the same external system and different translations into the same locale
+func mergeClashes(source, target *Survey, targetClassifiers map[string]ClassifierTypeSelector) []string {
+	var clashes, names, systems, locales []string
+	for _, c := range source.Classifiers {
+		if _, ok := targetClassifiers[c.Name]; ok {
+			names = append(names, c.Name)
+		}
+	}
+	if len(names) > 0 {
+		clashes = append(clashes, "Both surveys have classifier type selectors named "+strings.Join(names, ", "))
+	}
+
+	targetSystems := map[string]bool{}
+	for _, e := range target.ExternalIDs {
+		targetSystems[e.System] = true
+	}
+	for _, e := range source.ExternalIDs {
+		if targetSystems[e.System] {
+			systems = append(systems, e.System)
+		}
+	}
+	if len(systems) > 0 {
+		clashes = append(clashes, "Both surveys have external identifiers in "+strings.Join(systems, ", "))
+	}
+
+	for locale, translation := range source.Translations {
+		if existing, ok := target.Translations[locale]; ok && existing != translation {
+			locales = append(locales, locale)
+		}
+	}
+	if len(locales) > 0 {
+		sort.Strings(locales)
+		clashes = append(clashes, "Both surveys have different translations into "+strings.Join(locales, ", "))
+	}
+	return clashes
+}
+
+// mergeSurveyDetails moves the source's tags, external identifiers and translations onto the target, using strategy
+// for an external system or locale both surveys have. A tag the target already has, and anything strategy keeps
+// the target's version of, stays with the source.
+func (api *API) mergeSurveyDetails(tx *sql.Tx, source, target *Survey, strategy, actor string) *requestError {
+	targetTags := map[string]bool{}
+	for _, t := range target.Tags {
+		targetTags[t] = true
+	}
+	for _, t := range source.Tags {
+		if targetTags[t] {
+			continue
+		}
+		if _, err := tx.Stmt(api.DeleteSurveyTagStmt).Exec(source.ID, t); err != nil {
+			return newRequestError(http.StatusInternalServerError, "Error moving survey tag - %v", err)
+		}
+		if _, err := tx.Stmt(api.CreateSurveyTagStmt).Exec(target.ID, t, actor); err != nil {
+			return newRequestError(http.StatusInternalServerError, "Error moving survey tag - %v", err)
+		}
+	}
+
+	// An external identifier can't be combined, so combine keeps the target's as keep-target does
+	targetSystems := map[string]bool{}
+	for _, e := range target.ExternalIDs {
+		targetSystems[e.System] = true
+	}
+	for _, e := range source.ExternalIDs {
+		if targetSystems[e.System] && strategy != mergeKeepSource {
+			continue
+		}
+		// Each identifier finds one survey, so it's taken off the source before it's given to the target
+		if _, err := tx.Stmt(api.DeleteSurveyExternalIDStmt).Exec(source.ID, e.System); err != nil {
+			return newRequestError(http.StatusInternalServerError, "Error moving survey external identifier - %v", err)
+		}
+		if _, err := tx.Stmt(api.PutSurveyExternalIDStmt).Exec(target.ID, e.System, e.Identifier, actor); err != nil {
+			return newRequestError(http.StatusInternalServerError, "Error moving survey external identifier - %v", err)
+		}
+	}
+
+	locales := make([]string, 0, len(source.Translations))
+	for locale := range source.Translations {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	for _, locale := range locales {
+		translation := source.Translations[locale]
+		if existing, clash := target.Translations[locale]; clash && existing != translation {
+			if strategy == mergeKeepTarget {
+				continue
+			}
+			// Combining keeps the target's text, taking any it hasn't translated from the source
+			if strategy == mergeCombine {
+				combined := existing
+				sourceText := translation.fields()
+				for field, text := range combined.fields() {
+					if *text == "" {
+						*text = *sourceText[field]
+					}
+				}
+				translation = combined
+			}
+		}
+
+		for _, surveyID := range []string{source.ID, target.ID} {
+			if _, err := tx.Stmt(api.DeleteSurveyTranslationsStmt).Exec(surveyID, locale); err != nil {
+				return newRequestError(http.StatusInternalServerError, "Error moving survey translation - %v", err)
+			}
+		}
+		for field, text := range translation.fields() {
+			if *text == "" {
+				continue
+			}
+			if _, err := tx.Stmt(api.CreateSurveyTranslationStmt).Exec(target.ID, locale, field, *text, actor); err != nil {
+				return newRequestError(http.StatusInternalServerError, "Error moving survey translation - %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeClassifiers moves each of the source's classifier type selectors onto the target survey, using strategy for
+// those whose name the target already has. Selectors which aren't moved stay with the source.
+func (api *API) mergeClassifiers(tx *sql.Tx, targetID string, source []ClassifierTypeSelector, target map[string]ClassifierTypeSelector, strategy string) *requestError {
+	var targetPK int
+	if err := tx.Stmt(api.GetSurveyPKByID).QueryRow(targetID).Scan(&targetPK); err != nil {
+		return newRequestError(http.StatusInternalServerError, "Error getting survey to merge into - %v", err)
+	}
+
+	for _, c := range source {
+		existing, clash := target[c.Name]
+		if clash && strategy == mergeKeepTarget {
+			continue
+		}
+
+		if clash && strategy == mergeCombine {
+			have := map[string]bool{}
+			for _, t := range existing.ClassifierTypes {
+				have[t] = true
+			}
+			types := append([]string(nil), c.ClassifierTypes...)
+			sort.Strings(types)
+			for _, t := range types {
+				if have[t] {
+					continue
+				}
+				if _, err := tx.Stmt(api.AddClassifierTypeStmt).Exec(existing.ID, t); err != nil {
+					return newRequestError(http.StatusInternalServerError, "Error adding classifier type - %v", err)
+				}
+			}
+			continue
+		}
+
+		if clash {
+			if _, err := tx.Stmt(api.DeleteClassifierTypeSelectorStmt).Exec(existing.ID); err != nil {
+				return newRequestError(http.StatusInternalServerError, "Error replacing classifier type selector - %v", err)
+			}
+		}
+		if _, err := tx.Stmt(api.MoveClassifierTypeSelectorStmt).Exec(c.ID, targetPK); err != nil {
+			return newRequestError(http.StatusInternalServerError, "Error moving classifier type selector - %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const sourceSurveyID = "0b8d0f7c-0a25-4c3c-9d4b-2ad0d3c0f6a1"
+
+var snapshotColumns = []string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}
+
+// expectMergeLocks expects the target and source surveys of a merge to be locked
+func expectMergeLocks(m sqlmock.Sqlmock) {
+	for _, id := range []string{sourceSurveyID, surveyID} {
+		m.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(id).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	}
+}
+
+// expectMergeDetails expects the tags, owner, external identifiers and translations of a survey being merged to be read
+func expectMergeDetails(m sqlmock.Sqlmock, id string, survey, externalIDs, translations *sqlmock.Rows) {
+	m.ExpectPrepare("SELECT id, s.short_name, .+ARRAY\\(SELECT .+\\) .+ WHERE id = .+").ExpectQuery().WithArgs(id).WillReturnRows(survey)
+	m.ExpectPrepare("SELECT system, identifier FROM survey.survey_external_id .+").ExpectQuery().WithArgs(id).WillReturnRows(externalIDs)
+	m.ExpectPrepare("SELECT survey_id, locale, field, value FROM survey.survey_translation .+").ExpectQuery().WillReturnRows(translations)
+}
+
+func TestMergeSurveyCombine(t *testing.T) {
+	Convey("Survey merge moves the source's classifiers, tags, external identifiers and translations onto the target, keeps its names as aliases and archives it", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectBegin()
+		expectMergeLocks(mock)
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows(snapshotColumns).AddRow(surveyID, "VACS", "Vacancy Survey", "182", "STA1947", surveyType, "EQ", legalBasisLongName, nil, 4, "LIVE", nil, nil, nil))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE"))
+		expectMergeDetails(mock, surveyID, sqlmock.NewRows(surveyForUpdateColumns).AddRow(surveyID, "VACS", "Vacancy Survey", "182", "STA1947", surveyType, "EQ", legalBasisLongName, 4, "LIVE", nil, nil, nil, "{bres}", nil),
+			sqlmock.NewRows([]string{"system", "identifier"}).AddRow("IDBR", "182"),
+			sqlmock.NewRows([]string{"survey_id", "locale", "field", "value"}).AddRow(surveyID, "cy", "long_name", "Arolwg Swyddi Gwag"))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(sourceSurveyID).WillReturnRows(sqlmock.NewRows(snapshotColumns).AddRow(sourceSurveyID, "VACS2", "Vacancy Survey", "183", "STA1947", surveyType, "EQ", legalBasisLongName, nil, 2, "LIVE", nil, nil, nil))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(sourceSurveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow("11111111-1c0c-4c8e-8a70-4f6d2e6a0c11", "COLLECTION_INSTRUMENT", "FORM_TYPE").AddRow("11111111-1c0c-4c8e-8a70-4f6d2e6a0c11", "COLLECTION_INSTRUMENT", "EQ_ID").AddRow("22222222-1c0c-4c8e-8a70-4f6d2e6a0c11", "COMMUNICATION", "RU_REF"))
+		expectMergeDetails(mock, sourceSurveyID, sqlmock.NewRows(surveyForUpdateColumns).AddRow(sourceSurveyID, "VACS2", "Vacancy Survey", "183", "STA1947", surveyType, "EQ", legalBasisLongName, 2, "LIVE", nil, nil, nil, "{bres,fdi}", nil),
+			sqlmock.NewRows([]string{"system", "identifier"}).AddRow("IDBR", "183").AddRow("SDX", "183"),
+			sqlmock.NewRows([]string{"survey_id", "locale", "field", "value"}).AddRow(sourceSurveyID, "cy", "long_name", "Arolwg Swyddi Gwag 2").AddRow(sourceSurveyID, "cy", "legal_basis", "Deddf Ystadegau 1947"))
+		mock.ExpectPrepare("SELECT survey_pk FROM survey.survey WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"survey_pk"}).AddRow(1000))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertype \\(classifier_type_selector_fk, classifier_type\\) SELECT .+").ExpectExec().WithArgs(classifierID, "EQ_ID").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.classifiertypeselector SET survey_fk = .+").ExpectExec().WithArgs("22222222-1c0c-4c8e-8a70-4f6d2e6a0c11", 1000).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("DELETE FROM survey.survey_tag WHERE survey_id = .+ AND tag = .+").ExpectExec().WithArgs(sourceSurveyID, "fdi").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.survey_tag .+").ExpectExec().WithArgs(surveyID, "fdi", "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("DELETE FROM survey.survey_external_id WHERE survey_id = .+ AND system = .+").ExpectExec().WithArgs(sourceSurveyID, "SDX").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.survey_external_id .+").ExpectExec().WithArgs(surveyID, "SDX", "183", "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("DELETE FROM survey.survey_translation WHERE survey_id = .+ AND locale = .+").ExpectExec().WithArgs(sourceSurveyID, "cy").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectPrepare("DELETE FROM survey.survey_translation WHERE survey_id = .+ AND locale = .+").ExpectExec().WithArgs(surveyID, "cy").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.survey_translation .+").ExpectExec().WithArgs(surveyID, "cy", "long_name", "Arolwg Swyddi Gwag", "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.survey_translation .+").ExpectExec().WithArgs(surveyID, "cy", "legal_basis", "Deddf Ystadegau 1947", "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey_alias SET survey_id = .+").ExpectExec().WithArgs(sourceSurveyID, surveyID).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectPrepare("INSERT INTO survey.survey_alias .+").ExpectExec().WithArgs(surveyID, "SHORT_NAME", "VACS2", "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.survey_alias .+").ExpectExec().WithArgs(surveyID, "REF", "183", "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(sourceSurveyID).WillReturnRows(sqlmock.NewRows(snapshotColumns).AddRow(sourceSurveyID, "VACS2", "Vacancy Survey", "183", "STA1947", surveyType, "EQ", legalBasisLongName, nil, 2, "LIVE", nil, nil, nil))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(sourceSurveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow("11111111-1c0c-4c8e-8a70-4f6d2e6a0c11", "COLLECTION_INSTRUMENT", "FORM_TYPE").AddRow("11111111-1c0c-4c8e-8a70-4f6d2e6a0c11", "COLLECTION_INSTRUMENT", "EQ_ID"))
+		expectMergeDetails(mock, sourceSurveyID, sqlmock.NewRows(surveyForUpdateColumns).AddRow(sourceSurveyID, "VACS2", "Vacancy Survey", "183", "STA1947", surveyType, "EQ", legalBasisLongName, 2, "LIVE", nil, nil, nil, "{bres}", nil),
+			sqlmock.NewRows([]string{"system", "identifier"}).AddRow("IDBR", "183"),
+			sqlmock.NewRows([]string{"survey_id", "locale", "field", "value"}))
+		mock.ExpectPrepare("UPDATE survey.survey SET archived_at = now\\(\\) WHERE id = .+").ExpectQuery().WithArgs(sourceSurveyID).WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(time.Now()))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(sourceSurveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(sourceSurveyID, "unknown", "MERGE_SURVEY", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(5))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows(snapshotColumns).AddRow(surveyID, "VACS", "Vacancy Survey", "182", "STA1947", surveyType, "EQ", legalBasisLongName, nil, 5, "LIVE", nil, nil, nil))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "EQ_ID").AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE").AddRow("22222222-1c0c-4c8e-8a70-4f6d2e6a0c11", "COMMUNICATION", "RU_REF"))
+		expectMergeDetails(mock, surveyID, sqlmock.NewRows(surveyForUpdateColumns).AddRow(surveyID, "VACS", "Vacancy Survey", "182", "STA1947", surveyType, "EQ", legalBasisLongName, 5, "LIVE", nil, nil, nil, "{bres,fdi}", nil),
+			sqlmock.NewRows([]string{"system", "identifier"}).AddRow("IDBR", "182").AddRow("SDX", "183"),
+			sqlmock.NewRows([]string{"survey_id", "locale", "field", "value"}).AddRow(surveyID, "cy", "legal_basis", "Deddf Ystadegau 1947").AddRow(surveyID, "cy", "long_name", "Arolwg Swyddi Gwag"))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "MERGE_SURVEY", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/merge"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(`{"sourceId": "`+sourceSurveyID+`", "strategy": "combine"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"5"`)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Classifiers, ShouldHaveLength, 2)
+		So(res.Classifiers[0].ClassifierTypes, ShouldResemble, []string{"EQ_ID", "FORM_TYPE"})
+		So(res.Tags, ShouldResemble, []string{"bres", "fdi"})
+		So(res.ExternalIDs, ShouldBeNil)
+		So(res.Translations, ShouldBeNil)
+	})
+}
+
+func TestMergeSurveyClashFails(t *testing.T) {
+	Convey("Survey merge returns a 409 if both surveys have a classifier type selector with the same name or an identifier in the same system", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectBegin()
+		expectMergeLocks(mock)
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows(snapshotColumns).AddRow(surveyID, "VACS", "Vacancy Survey", "182", "STA1947", surveyType, "EQ", legalBasisLongName, nil, 4, "LIVE", nil, nil, nil))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE"))
+		expectMergeDetails(mock, surveyID, sqlmock.NewRows(surveyForUpdateColumns).AddRow(surveyID, "VACS", "Vacancy Survey", "182", "STA1947", surveyType, "EQ", legalBasisLongName, 4, "LIVE", nil, nil, nil, "{}", nil),
+			sqlmock.NewRows([]string{"system", "identifier"}).AddRow("IDBR", "182"),
+			sqlmock.NewRows([]string{"survey_id", "locale", "field", "value"}))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(sourceSurveyID).WillReturnRows(sqlmock.NewRows(snapshotColumns).AddRow(sourceSurveyID, "VACS2", "Vacancy Survey", "183", "STA1947", surveyType, "EQ", legalBasisLongName, nil, 2, "LIVE", nil, nil, nil))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(sourceSurveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow("11111111-1c0c-4c8e-8a70-4f6d2e6a0c11", "COLLECTION_INSTRUMENT", "FORM_TYPE"))
+		expectMergeDetails(mock, sourceSurveyID, sqlmock.NewRows(surveyForUpdateColumns).AddRow(sourceSurveyID, "VACS2", "Vacancy Survey", "183", "STA1947", surveyType, "EQ", legalBasisLongName, 2, "LIVE", nil, nil, nil, "{}", nil),
+			sqlmock.NewRows([]string{"system", "identifier"}).AddRow("IDBR", "183"),
+			sqlmock.NewRows([]string{"survey_id", "locale", "field", "value"}))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/merge"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(`{"sourceId": "`+sourceSurveyID+`"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, "Both surveys have classifier type selectors named COLLECTION_INSTRUMENT")
+		So(string(body), ShouldContainSubstring, "Both surveys have external identifiers in IDBR")
+	})
+}
+
+func TestMergeSurveyIntoItself(t *testing.T) {
+	Convey("Survey merge returns a 400 if the source is the target", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/merge"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(`{"sourceId": "`+surveyID+`"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+	})
+}
@@ -0,0 +1,292 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	validator2 "gopkg.in/go-playground/validator.v9"
+)
+
+// Phone numbers are digits, optionally starting with + for the country code, and may be grouped with spaces
+var validPhone = regexp.MustCompile(`^\+?[0-9][0-9 ]{5,18}[0-9]$`)
+
+// SurveyOwner represents the business area responsible for a survey and how to reach it
+type SurveyOwner struct {
+	Division           string         `json:"division" validate:"required,max=100"`
+	TeamMailbox        string         `json:"teamMailbox" validate:"required,email,max=254"`
+	Helpline           string         `json:"helpline,omitempty" validate:"omitempty,phone"`
+	EscalationContacts []OwnerContact `json:"escalationContacts" validate:"dive"`
+}
+
+// OwnerContact represents a person to escalate problems with a survey to
+type OwnerContact struct {
+	Name  string `json:"name" validate:"required,max=100"`
+	Email string `json:"email" validate:"required,email,max=254"`
+	Phone string `json:"phone,omitempty" validate:"omitempty,phone"`
+}
+
+// ownerColumn scans the owner the survey queries build as JSON into a Survey, leaving it nil if the survey has none
+type ownerColumn struct {
+	owner **SurveyOwner
+}
+
+func (c ownerColumn) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*c.owner = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.Errorf("cannot scan %T into survey owner", src)
+	}
+
+	owner := new(SurveyOwner)
+	if err := json.Unmarshal(data, owner); err != nil {
+		return err
+	}
+	*c.owner = owner
+	return nil
+}
+
+func validatePhone(fl validator2.FieldLevel) bool {
+	return validPhone.MatchString(fl.Field().String())
+}
+
+// ownerJSONField returns the path in JSON of a field of SurveyOwner which failed validation, e.g.
+// escalationContacts[0].email
+func ownerJSONField(fe validator2.FieldError) string {
+	parts := strings.Split(fe.StructNamespace(), ".")[1:]
+	for i, p := range parts {
+		r := []rune(p)
+		r[0] = unicode.ToLower(r[0])
+		parts[i] = string(r)
+	}
+	return strings.Join(parts, ".")
+}
+
+// GetSurveyOwner endpoint handler - returns the owner of the survey identified by surveyId
+func (api *API) GetSurveyOwner(w http.ResponseWriter, r *http.Request) {
+	surveyID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	survey, err := api.getSurvey(surveyID)
+	if err == sql.ErrNoRows {
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logErrorAndRespond(w, "Error getting survey owner", http.StatusInternalServerError, err)
+		return
+	}
+
+	if survey.Owner == nil {
+		writeRestErrorResponse(w, "Survey owner not found", http.StatusNotFound)
+		return
+	}
+
+	writeSurveyOwner(w, survey.Owner, survey.Version)
+}
+
+// PutSurveyOwner endpoint handler - sets, or replaces, the owner of the survey identified by surveyId
+func (api *API) PutSurveyOwner(w http.ResponseWriter, r *http.Request) {
+	surveyID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading request body", http.StatusInternalServerError, err)
+		return
+	}
+
+	owner := new(SurveyOwner)
+	if err := json.Unmarshal(body, owner); err != nil {
+		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
+	}
+	if owner.EscalationContacts == nil {
+		owner.EscalationContacts = []OwnerContact{}
+	}
+
+	if err := api.Validator.Struct(owner); err != nil {
+		validationErrors, ok := err.(validator2.ValidationErrors)
+		if !ok {
+			logErrorAndRespond(w, "Error validating survey owner", http.StatusInternalServerError, err)
+			return
+		}
+		fe := validationErrors[0]
+		http.Error(w, fmt.Sprintf("%s: %s", ownerJSONField(fe), validationMessage(fe)), http.StatusBadRequest)
+		return
+	}
+
+	contacts, err := json.Marshal(owner.EscalationContacts)
+	if err != nil {
+		logErrorAndRespond(w, "Error marshalling escalation contacts", http.StatusInternalServerError, err)
+		return
+	}
+
+	api.changeSurveyOwner(w, r, surveyID, auditSetOwner, owner, func(tx *sql.Tx, actor string) error {
+		_, err := tx.Stmt(api.PutSurveyOwnerStmt).Exec(surveyID, owner.Division, owner.TeamMailbox, optionalString(owner.Helpline), string(contacts), actor)
+		return err
+	})
+}
+
+// DeleteSurveyOwner endpoint handler - removes the owner of the survey identified by surveyId
+func (api *API) DeleteSurveyOwner(w http.ResponseWriter, r *http.Request) {
+	surveyID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	api.changeSurveyOwner(w, r, surveyID, auditRemoveOwner, nil, func(tx *sql.Tx, actor string) error {
+		_, err := tx.Stmt(api.DeleteSurveyOwnerStmt).Exec(surveyID)
+		return err
+	})
+}
+
+// changeSurveyOwner runs change in a transaction which checks the survey exists and matches If-Match, bumps its
+// version and audits operation. owner is the survey's owner afterwards, which is nil once it's removed.
+func (api *API) changeSurveyOwner(w http.ResponseWriter, r *http.Request, surveyID, operation string, owner *SurveyOwner,
+	change func(tx *sql.Tx, actor string) error) {
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	before, err := api.getSurveySnapshot(tx, surveyID)
+	if err == nil {
+		before.Owner, err = api.getSurveyOwner(tx, surveyID)
+	}
+	if err == sql.ErrNoRows || (err == nil && before.ArchivedAt != nil) {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error getting survey owner", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := api.checkIfMatch(tx, surveyID, r.Header.Get("If-Match")); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	if operation == auditRemoveOwner && before.Owner == nil {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey owner not found", http.StatusNotFound)
+		return
+	}
+
+	actor := requestActor(r)
+	if err := change(tx, actor); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to change survey owner", http.StatusInternalServerError, err)
+		return
+	}
+
+	version, err := api.bumpSurveyVersion(tx, surveyID)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to update survey version", http.StatusInternalServerError, err)
+		return
+	}
+
+	after := *before
+	after.Owner = owner
+	after.Version = version
+	if err := api.writeAudit(tx, actor, surveyID, operation, before, &after); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey owner", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Survey owner changed", zap.String("survey_id", surveyID), zap.String("operation", operation))
+	if owner == nil {
+		w.Header().Set("ETag", surveyETag(version))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeSurveyOwner(w, owner, version)
+}
+
+// getSurveyOwner returns the owner of a survey, or nil if it has none
+func (api *API) getSurveyOwner(tx *sql.Tx, surveyID string) (*SurveyOwner, error) {
+	owner := new(SurveyOwner)
+	var helpline sql.NullString
+	var contacts []byte
+	err := tx.Stmt(api.GetSurveyOwnerStmt).QueryRow(surveyID).Scan(&owner.Division, &owner.TeamMailbox, &helpline, &contacts)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	owner.Helpline = helpline.String
+	if err := json.Unmarshal(contacts, &owner.EscalationContacts); err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
+
+func writeSurveyOwner(w http.ResponseWriter, owner *SurveyOwner, version int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", surveyETag(version))
+	if err := json.NewEncoder(w).Encode(owner); err != nil {
+		logError("Error encoding response to 'survey owner'", err)
+	}
+}
+
+// SurveysByOwner endpoint handler - returns the current surveys owned by a division or team mailbox
+func (api *API) SurveysByOwner(w http.ResponseWriter, r *http.Request) {
+	owner := strings.TrimSpace(mux.Vars(r)["owner"])
+	if owner == "" {
+		http.Error(w, "Owner must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := api.GetSurveysByOwnerStmt.Query(owner)
+	if err != nil {
+		logErrorAndRespond(w, "Get surveys by owner query failed", http.StatusInternalServerError, err)
+		return
+	}
+
+	surveys, err := scanSurveys(rows)
+	if err != nil {
+		logErrorAndRespond(w, "Failed to get surveys from database", http.StatusInternalServerError, err)
+		return
+	}
+
+	if _, ok := api.localiseSurveys(w, r, surveys...); !ok {
+		return
+	}
+
+	writeSurveys(w, surveys)
+}
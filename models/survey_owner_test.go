@@ -0,0 +1,189 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ownerColumns = []string{"division", "team_mailbox", "helpline", "escalation_contacts"}
+
+func TestPutSurveyOwner(t *testing.T) {
+	Convey("Survey owner PUT sets the owner of the survey and returns it", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows(snapshotColumns).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, 3, "LIVE", nil, nil, nil))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectPrepare("SELECT division, team_mailbox, helpline, escalation_contacts FROM survey.survey_owner WHERE survey_id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows(ownerColumns))
+		mock.ExpectPrepare("INSERT INTO survey.survey_owner .+").ExpectExec().WithArgs(surveyID, "Economic Statistics", "bres@ons.gov.uk", "0300 123 4567", `[{"name":"Jo Bloggs","email":"jo.bloggs@ons.gov.uk"}]`, "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "SET_OWNER", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/owner"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"division": "Economic Statistics", "teamMailbox": "bres@ons.gov.uk", "helpline": "0300 123 4567",
+			"escalationContacts": [{"name": "Jo Bloggs", "email": "jo.bloggs@ons.gov.uk"}]}`
+		r, err := http.NewRequest("PUT", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"4"`)
+		res := models.SurveyOwner{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Division, ShouldEqual, "Economic Statistics")
+		So(res.EscalationContacts, ShouldResemble, []models.OwnerContact{{Name: "Jo Bloggs", Email: "jo.bloggs@ons.gov.uk"}})
+	})
+}
+
+func TestPutSurveyOwnerInvalidContact(t *testing.T) {
+	Convey("Survey owner PUT returns a 400 naming the field if a contact's email or phone isn't valid", t, func() {
+		for payload, message := range map[string]string{
+			`{"division": "Economic Statistics", "teamMailbox": "bres at ons.gov.uk"}`:                                                                               "teamMailbox: Value must be an email address",
+			`{"division": "Economic Statistics", "teamMailbox": "bres@ons.gov.uk", "helpline": "call us"}`:                                                           "helpline: Value must be a phone number",
+			`{"division": "Economic Statistics", "teamMailbox": "bres@ons.gov.uk", "escalationContacts": [{"name": "Jo", "email": "jo@ons.gov.uk", "phone": "12"}]}`: "escalationContacts[0].phone: Value must be a phone number",
+		} {
+			db, mock, err := sqlmock.New()
+			So(err, ShouldBeNil)
+			prepareMockStmts(mock)
+			db.Begin()
+
+			// When
+			api, err := models.NewAPI(db)
+			So(err, ShouldBeNil)
+
+			// Create a new router and plug in the defined routes
+			router := mux.NewRouter()
+			models.SetUpRoutes(router, api)
+
+			ts := httptest.NewServer(router)
+			url := ts.URL + "/surveys/" + surveyID + "/owner"
+			// User and password not set so base64encode the dividing character
+			basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+			r, err := http.NewRequest("PUT", url, strings.NewReader(payload))
+			r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+			resp, err := httpClient.Do(r)
+			So(err, ShouldBeNil)
+
+			// Then
+			So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+			body, err := io.ReadAll(resp.Body)
+			So(string(body), ShouldContainSubstring, message)
+
+			ts.Close()
+			api.Close()
+			db.Close()
+		}
+	})
+}
+
+func TestDeleteSurveyOwnerNotFound(t *testing.T) {
+	Convey("Survey owner DELETE returns a 404 if the survey has no owner", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows(snapshotColumns).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, 3, "LIVE", nil, nil, nil))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectPrepare("SELECT division, team_mailbox, helpline, escalation_contacts FROM survey.survey_owner WHERE survey_id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows(ownerColumns))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/owner"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("DELETE", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+	})
+}
+
+func TestSurveysByOwner(t *testing.T) {
+	Convey("Owner surveys GET returns the current surveys owned by a division with their owner", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		owner := []byte(`{"division": "Economic Statistics", "teamMailbox": "bres@ons.gov.uk", "helpline": null, "escalationContacts": []}`)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).
+			AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, "LIVE", nil, nil, nil, nil, owner)
+		mock.ExpectQuery("SELECT id, s.short_name, .+ WHERE EXISTS \\(SELECT 1 FROM survey.survey_owner o .+").WithArgs("economic statistics").WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/owners/economic%20statistics/surveys"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		var res []models.Survey
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res, ShouldHaveLength, 1)
+		So(res[0].Owner, ShouldResemble, &models.SurveyOwner{Division: "Economic Statistics", TeamMailbox: "bres@ons.gov.uk", EscalationContacts: []models.OwnerContact{}})
+	})
+}
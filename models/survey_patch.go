@@ -0,0 +1,239 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const mergePatchMediaType = "application/merge-patch+json"
+
+// mergePatch applies a JSON merge patch to target as described in RFC 7386. Members of the patch set to null are
+// removed from the target, objects are merged recursively and any other value replaces the target's value.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+
+	return targetObject
+}
+
+// applySurveyPatch returns a copy of survey with the merge patch applied
+func applySurveyPatch(survey *Survey, patch map[string]interface{}) (*Survey, error) {
+	data, err := json.Marshal(survey)
+	if err != nil {
+		return nil, err
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(mergePatch(document, patch))
+	if err != nil {
+		return nil, err
+	}
+
+	patched := new(Survey)
+	if err := json.Unmarshal(data, patched); err != nil {
+		return nil, err
+	}
+
+	// The legal basis can be given by either its reference or its long name, so whichever the caller changed
+	// has to win over the value left over from the current survey
+	if _, ok := patch["legalBasisRef"]; !ok {
+		if _, ok := patch["legalBasis"]; ok {
+			patched.LegalBasisRef = ""
+		}
+	}
+
+	return patched, nil
+}
+
+// checkSurveyPatch returns a message describing why patch can't be applied to the survey identified by surveyID, or
+// an empty string if it only touches fields which can be patched
+func checkSurveyPatch(surveyID string, patch map[string]interface{}) string {
+	if id, ok := patch["id"]; ok && id != surveyID {
+		return "The survey id cannot be changed"
+	}
+
+	if _, ok := patch["classifiers"]; ok {
+		return "Classifiers cannot be changed by patching a survey"
+	}
+
+	if _, ok := patch["tags"]; ok {
+		return "The tags of a survey are changed with PUT and DELETE /surveys/{surveyId}/tags/{tag}"
+	}
+
+	if _, ok := patch["owner"]; ok {
+		return "The owner of a survey is changed with PUT and DELETE /surveys/{surveyId}/owner"
+	}
+
+	if _, ok := patch["translations"]; ok {
+		return "The translations of a survey are changed with PUT and DELETE /surveys/{surveyId}/translations/{locale}"
+	}
+
+	if _, ok := patch["externalIds"]; ok {
+		return "The external identifiers of a survey are changed with PUT and DELETE /surveys/{surveyId}/externalids/{system}"
+	}
+
+	if _, ok := patch["archivedAt"]; ok {
+		return "Surveys are archived by deleting them and restored with POST /surveys/{surveyId}/restore"
+	}
+
+	if _, ok := patch["status"]; ok {
+		return "The status of a survey is changed with POST /surveys/{surveyId}/status"
+	}
+
+	return ""
+}
+
+// PatchSurvey endpoint handler - updates the survey identified by surveyId using a JSON merge patch
+func (api *API) PatchSurvey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	surveyID := vars["surveyId"]
+	logger.Info("Patching survey", zap.String("surveyID", surveyID))
+
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ["+surveyID+"] is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != mergePatchMediaType {
+		http.Error(w, "Content-Type must be "+mergePatchMediaType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading survey patch", http.StatusInternalServerError, err)
+		return
+	}
+
+	var patch map[string]interface{}
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
+	}
+
+	if message := checkSurveyPatch(surveyID, patch); message != "" {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+
+	// The survey is read and patched inside the transaction with its row locked, so concurrent patches are applied
+	// one after another rather than each overwriting the other's changes
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	survey, err := api.getSurveyForUpdate(tx, surveyID)
+	if err == sql.ErrNoRows {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error retrieving survey by survey ID", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := matchIfMatch(r.Header.Get("If-Match"), survey.Version); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	patched, err := applySurveyPatch(survey, patch)
+	if err != nil {
+		rollBack(tx)
+		http.Error(w, "Error applying patch - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	legalBasis, reqErr := api.firstSurveyProblem(patched, survey.Reference)
+	if reqErr != nil {
+		rollBack(tx)
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+	patched.LegalBasisRef = legalBasis.Reference
+	patched.LegalBasis = legalBasis.LongName
+
+	actor := requestActor(r)
+	if reqErr := api.recordRename(tx, surveyID, actor, survey, patched); reqErr != nil {
+		rollBack(tx)
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+
+	_, err = tx.Stmt(api.UpdateSurveyStmt).Exec(
+		surveyID,
+		patched.Reference,
+		patched.ShortName,
+		patched.LongName,
+		patched.LegalBasisRef,
+		patched.SurveyType,
+		patched.SurveyMode,
+		patched.Periodicity,
+		patched.PeriodFormat,
+		patched.Attributes,
+	)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Update survey query failed", http.StatusInternalServerError, err)
+		return
+	}
+
+	version, err := api.bumpSurveyVersion(tx, surveyID)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to update survey version", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := api.writeAudit(tx, actor, surveyID, auditPatchSurvey, survey, patched); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey patch", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully patched survey", zap.String("surveyID", surveyID))
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", surveyETag(version))
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(patched); err != nil {
+		logError("Error encoding response to 'patch survey'", err)
+	}
+}
@@ -0,0 +1,238 @@
+package models_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPatchSurveySuccess(t *testing.T) {
+	Convey("Survey PATCH applies a merge patch and returns the updated survey", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, "Statistics of Trade Act 1947", 1, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("Vol").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("Vol", "Voluntary Not Stated"))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}).AddRow(reference))
+		mock.ExpectPrepare("UPDATE survey.survey SET survey_ref = .+ WHERE id = .+").ExpectExec().WithArgs(surveyID, reference, shortName, longName, "Vol", "Social", "EQ", nil, nil, "{}").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "PATCH_SURVEY", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		var jsonStr = []byte(`{"surveyMode": "EQ", "surveyType": "Social", "legalBasisRef": "Vol"}`)
+		r, err := http.NewRequest("PATCH", url, bytes.NewBuffer(jsonStr))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/merge-patch+json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		json.Unmarshal(body, &res)
+		So(res.ShortName, ShouldEqual, shortName)
+		So(res.SurveyMode, ShouldEqual, "EQ")
+		So(res.SurveyType, ShouldEqual, "Social")
+		So(res.LegalBasisRef, ShouldEqual, "Vol")
+		So(res.LegalBasis, ShouldEqual, "Voluntary Not Stated")
+	})
+}
+
+func TestPatchSurveyRequiresMergePatchContentType(t *testing.T) {
+	Convey("Survey PATCH returns a 415 for content other than a merge patch", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("PATCH", url, bytes.NewBuffer([]byte(`{"surveyMode": "EQ"}`)))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusUnsupportedMediaType)
+	})
+}
+
+func TestPatchSurveyNotFound(t *testing.T) {
+	Convey("Survey PATCH returns a 404 for an unknown survey", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("PATCH", url, bytes.NewBuffer([]byte(`{"surveyMode": "EQ"}`)))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/merge-patch+json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, `{"code":"404","message":"Survey not found",`)
+	})
+}
+
+func TestPatchSurveyShortNameRecordsAlias(t *testing.T) {
+	Convey("Survey PATCH of the short name keeps the old one as an alias", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAttributeDefinitions(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, "Statistics of Trade Act 1947", 1, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", "Statistics of Trade Act 1947"))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs("NEWNAME").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectPrepare("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").ExpectQuery().WithArgs("SHORT_NAME", "NEWNAME").WillReturnRows(sqlmock.NewRows([]string{"survey_id"}))
+		mock.ExpectPrepare("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").ExpectQuery().WithArgs("REF", reference).WillReturnRows(sqlmock.NewRows([]string{"survey_id"}))
+		mock.ExpectPrepare("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").ExpectQuery().WithArgs("SHORT_NAME", "NEWNAME").WillReturnRows(sqlmock.NewRows([]string{"survey_id"}))
+		mock.ExpectPrepare("INSERT INTO survey.survey_alias .+").ExpectExec().WithArgs(surveyID, "SHORT_NAME", shortName, "unknown").WillReturnError(&pq.Error{Code: "23505"})
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("PATCH", url, bytes.NewBufferString(`{"shortName": "NEWNAME"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/merge-patch+json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, shortName+" is already an alias of another survey")
+	})
+}
+
+func TestPatchSurveyDuplicateShortName(t *testing.T) {
+	Convey("Survey PATCH returns a 409 when the short name belongs to another survey", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, "Statistics of Trade Act 1947", 1, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", "Statistics of Trade Act 1947"))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs("BRES").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}).AddRow("221"))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("PATCH", url, bytes.NewBuffer([]byte(`{"shortName": "BRES"}`)))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/merge-patch+json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, "The survey with Abbreviation BRES already exists")
+	})
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+)
+
+var validPeriodicities = map[string]bool{"WEEKLY": true, "MONTHLY": true, "QUARTERLY": true, "ANNUAL": true, "AD_HOC": true}
+
+// periodFormats maps each period format onto the pattern a period in that format matches and an example of one
+var periodFormats = map[string]struct {
+	pattern *regexp.Regexp
+	example string
+}{
+	"YYYY":   {regexp.MustCompile(`^\d{4}$`), "2024"},
+	"YYYYMM": {regexp.MustCompile(`^\d{4}(0[1-9]|1[0-2])$`), "202403"},
+	"YYYYQ":  {regexp.MustCompile(`^\d{4}[1-4]$`), "20241"},
+	"YYYYWW": {regexp.MustCompile(`^\d{4}(0[1-9]|[1-4]\d|5[0-3])$`), "202412"},
+}
+
+// allowedPeriodFormats lists the period formats a survey with each periodicity can have. The first is the survey's
+// period format unless it has its own. Quarterly and annual business surveys are often labelled by the last month they
+// cover, e.g. 202403. Ad hoc surveys can have any period format, and have no default.
+var allowedPeriodFormats = map[string][]string{
+	"WEEKLY":    {"YYYYWW"},
+	"MONTHLY":   {"YYYYMM"},
+	"QUARTERLY": {"YYYYQ", "YYYYMM"},
+	"ANNUAL":    {"YYYY", "YYYYMM"},
+}
+
+// PeriodValidation is the result of checking a period against the period format of a survey
+type PeriodValidation struct {
+	Period       string `json:"period"`
+	PeriodFormat string `json:"periodFormat"`
+	Valid        bool   `json:"valid"`
+	Message      string `json:"message,omitempty"`
+}
+
+// checkPeriodicity returns the JSON field and a message describing what's wrong with the periodicity or period
+// format of a survey, or an empty message if they're valid. Both are optional, but if both are given the period format
+// has to be one allowed for the periodicity.
+func checkPeriodicity(survey *Survey) (string, string) {
+	if survey.Periodicity != nil && !validPeriodicities[*survey.Periodicity] {
+		return "periodicity", "Periodicity must be one of [WEEKLY, MONTHLY, QUARTERLY, ANNUAL, AD_HOC]"
+	}
+	if survey.PeriodFormat == nil {
+		return "", ""
+	}
+	if _, ok := periodFormats[*survey.PeriodFormat]; !ok {
+		return "periodFormat", "Period format must be one of [YYYY, YYYYMM, YYYYQ, YYYYWW]"
+	}
+
+	if survey.Periodicity != nil {
+		allowed := allowedPeriodFormats[*survey.Periodicity]
+		for _, format := range allowed {
+			if format == *survey.PeriodFormat {
+				return "", ""
+			}
+		}
+		if len(allowed) > 0 {
+			return "periodFormat", fmt.Sprintf("Period format %v can't be used by %v surveys, which must use one of [%v]",
+				*survey.PeriodFormat, *survey.Periodicity, strings.Join(allowed, ", "))
+		}
+	}
+	return "", ""
+}
+
+// surveyPeriodFormat returns the period format periods of the survey are in, or an empty string if it doesn't have one
+func surveyPeriodFormat(survey *Survey) string {
+	if survey.PeriodFormat != nil {
+		return *survey.PeriodFormat
+	}
+	if survey.Periodicity != nil {
+		if formats := allowedPeriodFormats[*survey.Periodicity]; len(formats) > 0 {
+			return formats[0]
+		}
+	}
+	return ""
+}
+
+// checkPeriod returns a message describing why period isn't a valid period in format, or an empty string if it is
+func checkPeriod(period, format string) string {
+	f := periodFormats[format]
+	if !f.pattern.MatchString(period) {
+		return fmt.Sprintf("Period %v doesn't match the %v format, e.g. %v", period, format, f.example)
+	}
+
+	// Only some years have a 53rd ISO week
+	if format == "YYYYWW" && period[4:] == "53" {
+		year, _ := strconv.Atoi(period[:4])
+		if _, weeks := time.Date(year, time.December, 28, 0, 0, 0, 0, time.UTC).ISOWeek(); weeks < 53 {
+			return fmt.Sprintf("Period %v is not a valid week, %d has %d weeks", period, year, weeks)
+		}
+	}
+	return ""
+}
+
+// ValidatePeriod endpoint handler - checks the period query parameter against the period format of the survey
+func (api *API) ValidatePeriod(w http.ResponseWriter, r *http.Request) {
+	surveyID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		http.Error(w, "A period is required", http.StatusBadRequest)
+		return
+	}
+
+	survey, err := api.getSurvey(surveyID)
+	if err == sql.ErrNoRows {
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logErrorAndRespond(w, "Error retrieving survey by survey ID", http.StatusInternalServerError, err)
+		return
+	}
+
+	format := surveyPeriodFormat(survey)
+	if format == "" {
+		http.Error(w, "Survey "+survey.ShortName+" has no period format to validate against", http.StatusUnprocessableEntity)
+		return
+	}
+
+	validation := PeriodValidation{Period: period, PeriodFormat: format}
+	validation.Message = checkPeriod(period, format)
+	validation.Valid = validation.Message == ""
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(validation); err != nil {
+		logError("Error encoding response to 'validate period'", err)
+	}
+}
+
+// optionalString returns a pointer to s, or nil if it's empty
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// stringValue returns the string s points to, or an empty string if it's nil
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
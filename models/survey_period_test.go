@@ -0,0 +1,183 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var periodSurveyColumns = []string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}
+
+func TestValidatePeriodMonthly(t *testing.T) {
+	Convey("Period validation checks a period against the default format of a monthly survey", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows(periodSurveyColumns).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, 1, "LIVE", "MONTHLY", nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s .+ WHERE id = ?").ExpectQuery().WithArgs(surveyID).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/periods/validate?period=202413"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.PeriodValidation{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Period, ShouldEqual, "202413")
+		So(res.PeriodFormat, ShouldEqual, "YYYYMM")
+		So(res.Valid, ShouldBeFalse)
+		So(res.Message, ShouldContainSubstring, "202403")
+	})
+}
+
+func TestValidatePeriodWeekFiftyThree(t *testing.T) {
+	Convey("Period validation only accepts week 53 in years which have one", t, func() {
+		for period, valid := range map[string]bool{"202053": true, "202153": false} {
+			db, mock, err := sqlmock.New()
+			So(err, ShouldBeNil)
+			prepareMockStmts(mock)
+			rows := sqlmock.NewRows(periodSurveyColumns).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, 1, "LIVE", "AD_HOC", "YYYYWW", nil, nil, nil)
+			mock.ExpectPrepare("SELECT id, s.short_name, .+, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s .+ WHERE id = ?").ExpectQuery().WithArgs(surveyID).WillReturnRows(rows)
+			db.Begin()
+
+			// When
+			api, err := models.NewAPI(db)
+			So(err, ShouldBeNil)
+
+			// Create a new router and plug in the defined routes
+			router := mux.NewRouter()
+			models.SetUpRoutes(router, api)
+
+			ts := httptest.NewServer(router)
+			url := ts.URL + "/surveys/" + surveyID + "/periods/validate?period=" + period
+			// User and password not set so base64encode the dividing character
+			basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+			r, err := http.NewRequest("GET", url, nil)
+			r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+			resp, err := httpClient.Do(r)
+			So(err, ShouldBeNil)
+
+			// Then
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			res := models.PeriodValidation{}
+			body, err := io.ReadAll(resp.Body)
+			So(json.Unmarshal(body, &res), ShouldBeNil)
+			So(res.PeriodFormat, ShouldEqual, "YYYYWW")
+			So(res.Valid, ShouldEqual, valid)
+
+			ts.Close()
+			api.Close()
+			db.Close()
+		}
+	})
+}
+
+func TestValidatePeriodWithoutPeriodFormat(t *testing.T) {
+	Convey("Period validation returns a 422 if the survey has no period format", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows(periodSurveyColumns).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, 1, "LIVE", "AD_HOC", nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s .+ WHERE id = ?").ExpectQuery().WithArgs(surveyID).WillReturnRows(rows)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/periods/validate?period=2024"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusUnprocessableEntity)
+	})
+}
+
+func TestValidateSurveyPeriodFormatNotAllowedForPeriodicity(t *testing.T) {
+	Convey("Survey validate rejects a period format which can't be used with the survey's periodicity", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys:validate"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "` + reference + `", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "SEFT",
+			"periodicity": "MONTHLY", "periodFormat": "YYYYQ"}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.SurveyValidation{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Valid, ShouldBeFalse)
+		So(res.Errors, ShouldResemble, []models.FieldError{{Field: "periodFormat", Message: "Period format YYYYQ can't be used by MONTHLY surveys, which must use one of [YYYYMM]"}})
+	})
+}
@@ -0,0 +1,247 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// replaceClassifiers deletes the classifier type selectors of the survey with primary key surveyPK and inserts
+// classifiers in their place using transaction tx. A selector keeps its UUID if its name hasn't changed, otherwise
+// it takes the UUID given for it, if any. The UUIDs of the inserted selectors are set on classifiers.
+func (api *API) replaceClassifiers(surveyID string, surveyPK int, classifiers []ClassifierTypeSelector, tx *sql.Tx) error {
+	rows, err := tx.Stmt(api.GetClassifierTypeSelectorStmt).Query(surveyID)
+	if err != nil {
+		return errors.Wrap(err, "Error getting existing classifier type selectors")
+	}
+
+	existingIDs := make(map[string]uuid.UUID)
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "Error reading existing classifier type selectors")
+		}
+		existingIDs[name] = uuid.FromStringOrNil(id)
+	}
+	rows.Close()
+
+	// Cascading foreign keys take care of the deletion of the associated classifiertype records
+	if _, err := tx.Stmt(api.DeleteClassifierTypeSelectorsStmt).Exec(surveyPK); err != nil {
+		return errors.Wrap(err, "Error deleting existing classifier type selectors")
+	}
+
+	for i, c := range classifiers {
+		classifierTypeSelectorID, ok := existingIDs[c.Name]
+		if !ok {
+			classifierTypeSelectorID = uuid.FromStringOrNil(c.ID)
+		}
+
+		typeSelectorPK, classifierTypeSelectorID, err := api.insertClassifierTypeSelector(c.Name, surveyPK, classifierTypeSelectorID, tx)
+		if err != nil {
+			return errors.Wrap(err, "Error inserting classifier type selector '"+c.Name+"'")
+		}
+
+		if err := api.insertClassifierTypes(c.ClassifierTypes, typeSelectorPK, tx); err != nil {
+			return errors.Wrap(err, "Error inserting classifier types for '"+c.Name+"'")
+		}
+		classifiers[i].ID = classifierTypeSelectorID.String()
+	}
+	return nil
+}
+
+// checkSurveyReplacement returns why survey can't replace a survey, or an empty string if it can. The fields which
+// have their own endpoints are refused rather than dropped.
+func checkSurveyReplacement(survey *Survey) string {
+	if survey.Tags != nil {
+		return "The tags of a survey are changed with PUT and DELETE /surveys/{surveyId}/tags/{tag}"
+	}
+
+	if survey.Owner != nil {
+		return "The owner of a survey is changed with PUT and DELETE /surveys/{surveyId}/owner"
+	}
+
+	if survey.Translations != nil {
+		return "The translations of a survey are changed with PUT and DELETE /surveys/{surveyId}/translations/{locale}"
+	}
+
+	if survey.ExternalIDs != nil {
+		return "The external identifiers of a survey are changed with PUT and DELETE /surveys/{surveyId}/externalids/{system}"
+	}
+
+	return ""
+}
+
+// PutSurvey endpoint handler - replaces the survey identified by surveyId, including its classifiers, with the
+// JSON in the request, creating the survey if it doesn't already exist
+func (api *API) PutSurvey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	surveyID := vars["surveyId"]
+	logger.Info("Replacing survey", zap.String("surveyID", surveyID))
+
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ["+surveyID+"] is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading survey", http.StatusInternalServerError, err)
+		return
+	}
+
+	var survey Survey
+	if err := json.Unmarshal(body, &survey); err != nil {
+		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
+	}
+
+	if survey.ID != "" && survey.ID != surveyID {
+		http.Error(w, "The survey id cannot be changed", http.StatusBadRequest)
+		return
+	}
+	if reason := checkSurveyReplacement(&survey); reason != "" {
+		http.Error(w, reason, http.StatusBadRequest)
+		return
+	}
+	survey.ID = surveyID
+	survey.ArchivedAt = nil
+
+	// Start database transaction
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// Lock the survey so it can't change between being read and replaced
+	var existing *Survey
+	var lockedVersion int
+	err = tx.Stmt(api.LockSurveyVersionStmt).QueryRow(surveyID).Scan(&lockedVersion)
+	if err == nil {
+		existing, err = api.getSurveySnapshot(tx, surveyID)
+	}
+	created := err == sql.ErrNoRows
+	if err != nil && !created {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error retrieving survey by survey ID", http.StatusInternalServerError, err)
+		return
+	}
+
+	if !created && existing.ArchivedAt != nil {
+		rollBack(tx)
+		http.Error(w, "The survey is archived and must be restored before it can be replaced", http.StatusConflict)
+		return
+	}
+
+	// The status can only be changed through POST /surveys/{surveyId}/status
+	currentRef := ""
+	if !created {
+		currentRef = existing.Reference
+		survey.Status = existing.Status
+	}
+
+	legalBasis, reqErr := api.firstSurveyProblem(&survey, currentRef)
+	if reqErr != nil {
+		rollBack(tx)
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+	survey.LegalBasisRef = legalBasis.Reference
+	survey.LegalBasis = legalBasis.LongName
+
+	if err := api.checkIfMatch(tx, surveyID, r.Header.Get("If-Match")); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	actor := requestActor(r)
+	if !created {
+		if reqErr := api.recordRename(tx, surveyID, actor, existing, &survey); reqErr != nil {
+			rollBack(tx)
+			http.Error(w, reqErr.message, reqErr.status)
+			return
+		}
+	}
+
+	var surveyPK, version int
+	if created {
+		err = tx.Stmt(api.CreateSurveyStmt).QueryRow(survey.ID, survey.Reference, survey.ShortName, survey.LongName,
+			survey.LegalBasisRef, survey.SurveyType, survey.SurveyMode, survey.Periodicity, survey.PeriodFormat, survey.Attributes).Scan(&surveyPK, &version, &survey.Status)
+	} else {
+		_, err = tx.Stmt(api.UpdateSurveyStmt).Exec(survey.ID, survey.Reference, survey.ShortName, survey.LongName,
+			survey.LegalBasisRef, survey.SurveyType, survey.SurveyMode, survey.Periodicity, survey.PeriodFormat, survey.Attributes)
+		if err == nil {
+			err = tx.Stmt(api.GetSurveyPKByID).QueryRow(survey.ID).Scan(&surveyPK)
+		}
+		if err == nil {
+			version, err = api.bumpSurveyVersion(tx, survey.ID)
+		}
+	}
+	if err == nil {
+		err = api.replaceClassifiers(survey.ID, surveyPK, survey.Classifiers, tx)
+	}
+	if isUniqueViolation(errors.Cause(err)) {
+		// Another request got there first after the survey was checked
+		rollBack(tx)
+		http.Error(w, "A survey with the same id, short name or reference, or a classifier type selector with the same id, already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, fmt.Sprintf("Failed to write survey '%s'", survey.ID), http.StatusInternalServerError, err)
+		return
+	}
+
+	// The response is what's stored, which includes the tags and owner the survey already has
+	stored, err := api.getSurveyInTx(tx, surveyID)
+	if err == nil {
+		stored.Classifiers, err = api.getSurveyClassifiers(tx, surveyID)
+	}
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error retrieving replaced survey", http.StatusInternalServerError, err)
+		return
+	}
+
+	operation := auditReplaceSurvey
+	var beforeState interface{}
+	if created {
+		operation = auditCreateSurvey
+	} else {
+		beforeState = existing
+	}
+	after := *stored
+	after.Tags, after.Owner = nil, nil
+	if err := api.writeAudit(tx, actor, surveyID, operation, beforeState, after); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey replacement", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	logger.Info("Successfully replaced survey", zap.String("surveyID", surveyID), zap.Bool("created", created))
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", surveyETag(stored.Version))
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(stored); err != nil {
+		logError("Error encoding response to 'put survey'", err)
+	}
+}
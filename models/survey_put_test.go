@@ -0,0 +1,274 @@
+package models_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPutSurveyCreatesSurvey(t *testing.T) {
+	Convey("Survey PUT creates a survey which doesn't exist and keeps the ids given for its classifiers", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		noRows := sqlmock.NewRows([]string{"survey_ref"})
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}))
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE long_name = .+").ExpectQuery().WithArgs("Statistics of Trade Act 1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", "Statistics of Trade Act 1947"))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(shortName).WillReturnRows(noRows)
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectPrepare("SELECT EXISTS \\(SELECT 1 FROM survey.survey WHERE id = .+\\)").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectPrepare("INSERT INTO survey.survey .+").ExpectQuery().WithArgs(surveyID, reference, shortName, longName, "STA1947", surveyType, surveyMode, nil, nil, "{}").WillReturnRows(sqlmock.NewRows([]string{"survey_pk", "version", "status"}).AddRow(1000, 1, "LIVE"))
+		mock.ExpectPrepare("SELECT classifiertypeselector.id, classifier_type_selector .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector"}))
+		mock.ExpectPrepare("DELETE FROM survey.classifiertypeselector .+").ExpectExec().WithArgs(1000).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectPrepare("SELECT id FROM survey.classifiertypeselector WHERE id = ANY\\(.+\\)").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertypeselector .+").ExpectQuery().WithArgs(classifierID, 1000, "COLLECTION_INSTRUMENT").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2000))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertype .+").ExpectExec().WithArgs(2000, "FORM_TYPE").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("SELECT id, .+ARRAY\\(SELECT t.tag .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, "Statistics of Trade Act 1947", 1, "DESIGN", nil, nil, nil, nil, nil))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE"))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "CREATE_SURVEY", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		var jsonStr = []byte(`{"shortName": "test-shortname", "longName": "test-longname", "surveyRef": "test-reference", "legalBasis": "Statistics of Trade Act 1947", "surveyType": "Business", "surveyMode": "SEFT",
+			"classifiers": [{"id": "` + classifierID + `", "name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE"]}]}`)
+		r, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonStr))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		json.Unmarshal(body, &res)
+		So(res.ID, ShouldEqual, surveyID)
+		So(res.LegalBasisRef, ShouldEqual, "STA1947")
+		So(res.Status, ShouldEqual, "DESIGN")
+		So(res.Classifiers, ShouldHaveLength, 1)
+		So(res.Classifiers[0].ID, ShouldEqual, classifierID)
+	})
+}
+
+func TestPutSurveyReplacesSurvey(t *testing.T) {
+	Convey("Survey PUT replaces an existing survey and keeps the ids of unchanged classifiers", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, "Statistics of Trade Act 1947", nil, 1, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", "Statistics of Trade Act 1947"))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}).AddRow(reference))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE"))
+		mock.ExpectPrepare("UPDATE survey.survey SET survey_ref = .+ WHERE id = .+").ExpectExec().WithArgs(surveyID, reference, shortName, "new-longname", "STA1947", surveyType, "EQ", nil, nil, "{}").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("SELECT survey_pk FROM survey.survey WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"survey_pk"}).AddRow(1000))
+		mock.ExpectPrepare("SELECT classifiertypeselector.id, classifier_type_selector .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector"}).AddRow(classifierID, "COLLECTION_INSTRUMENT"))
+		mock.ExpectPrepare("DELETE FROM survey.classifiertypeselector .+").ExpectExec().WithArgs(1000).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertypeselector .+").ExpectQuery().WithArgs(classifierID, 1000, "COLLECTION_INSTRUMENT").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2000))
+		mock.ExpectPrepare("INSERT INTO survey.classifiertype .+").ExpectExec().WithArgs(2000, "RU_REF").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectPrepare("SELECT id, .+ARRAY\\(SELECT t.tag .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, "new-longname", reference, "STA1947", surveyType, "EQ", "Statistics of Trade Act 1947", 2, "LIVE", nil, nil, nil, "{BRES}", nil))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "RU_REF"))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "REPLACE_SURVEY", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		var jsonStr = []byte(`{"shortName": "test-shortname", "longName": "new-longname", "surveyRef": "test-reference", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "EQ",
+			"classifiers": [{"name": "COLLECTION_INSTRUMENT", "classifierTypes": ["RU_REF"]}]}`)
+		r, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonStr))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		json.Unmarshal(body, &res)
+		So(res.LongName, ShouldEqual, "new-longname")
+		So(res.Tags, ShouldResemble, []string{"BRES"})
+		So(res.Classifiers[0].ID, ShouldEqual, classifierID)
+	})
+}
+
+func TestPutSurveyUniqueViolation(t *testing.T) {
+	Convey("Survey PUT returns a 409 if another survey takes the short name or reference before it is written", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, "Statistics of Trade Act 1947", nil, 1, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", "Statistics of Trade Act 1947"))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}).AddRow(reference))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE"))
+		mock.ExpectPrepare("UPDATE survey.survey SET survey_ref = .+ WHERE id = .+").ExpectExec().WithArgs(surveyID, reference, shortName, "new-longname", "STA1947", surveyType, "EQ", nil, nil, "{}").WillReturnError(&pq.Error{Code: "23505"})
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		var jsonStr = []byte(`{"shortName": "test-shortname", "longName": "new-longname", "surveyRef": "test-reference", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "EQ",
+			"classifiers": [{"name": "COLLECTION_INSTRUMENT", "classifierTypes": ["RU_REF"]}]}`)
+		r, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonStr))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+	})
+}
+
+func TestPutSurveyDuplicateClassifiers(t *testing.T) {
+	Convey("Survey PUT returns a 400 when a classifier is given twice", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, "Statistics of Trade Act 1947", nil, 1, "LIVE", nil, nil, nil)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", "Statistics of Trade Act 1947"))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}).AddRow(reference))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		var jsonStr = []byte(`{"shortName": "test-shortname", "longName": "test-longname", "surveyRef": "test-reference", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "EQ",
+			"classifiers": [{"name": "COLLECTION_INSTRUMENT", "classifierTypes": ["RU_REF"]}, {"name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE"]}]}`)
+		r, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonStr))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, "Classifier type selector is given more than once")
+	})
+}
+
+func TestPutSurveyRejectsTags(t *testing.T) {
+	Convey("Survey PUT returns a 400 rather than dropping the tags given for a survey", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		var jsonStr = []byte(`{"shortName": "test-shortname", "longName": "test-longname", "surveyRef": "test-reference", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "EQ", "tags": ["BRES"]}`)
+		r, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonStr))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, "The tags of a survey are changed with PUT and DELETE /surveys/{surveyId}/tags/{tag}")
+	})
+}
@@ -0,0 +1,267 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// The kinds of name a survey can be known by after it's renamed
+const (
+	aliasShortName = "SHORT_NAME"
+	aliasRef       = "REF"
+)
+
+// SurveyRename holds the new short name and reference of a survey. Either can be left out to keep the current one.
+type SurveyRename struct {
+	ShortName string `json:"shortName"`
+	Reference string `json:"surveyRef"`
+}
+
+// SurveyAlias represents a short name or reference a survey was previously known by
+type SurveyAlias struct {
+	Kind      string    `json:"kind"`
+	Alias     string    `json:"alias"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RenameSurvey endpoint handler - changes the short name and/or reference of a survey, keeping the old ones as aliases
+// so the survey can still be found by them
+func (api *API) RenameSurvey(w http.ResponseWriter, r *http.Request) {
+	surveyID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading request body", http.StatusInternalServerError, err)
+		return
+	}
+	var rename SurveyRename
+	if err := json.Unmarshal(body, &rename); err != nil {
+		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
+	}
+	if rename.ShortName == "" && rename.Reference == "" {
+		http.Error(w, "A new shortName or surveyRef is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// Lock the survey so the aliases and history are recorded against what's actually renamed
+	before, err := api.getSurveyForUpdate(tx, surveyID)
+	if err == sql.ErrNoRows {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error getting survey to rename", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := api.checkIfMatch(tx, surveyID, r.Header.Get("If-Match")); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	after := *before
+	if rename.ShortName != "" {
+		after.ShortName = rename.ShortName
+	}
+	if rename.Reference != "" {
+		after.Reference = rename.Reference
+	}
+
+	// A rename to the current names changes nothing
+	if after.ShortName == before.ShortName && after.Reference == before.Reference {
+		rollBack(tx)
+		writeSurvey(w, before)
+		return
+	}
+
+	if _, reqErr := api.firstSurveyProblem(&after, before.Reference); reqErr != nil {
+		rollBack(tx)
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+
+	actor := requestActor(r)
+	if reqErr := api.recordRename(tx, surveyID, actor, before, &after); reqErr != nil {
+		rollBack(tx)
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+
+	if _, err := tx.Stmt(api.RenameSurveyStmt).Exec(surveyID, after.ShortName, after.Reference); err != nil {
+		rollBack(tx)
+		if isUniqueViolation(err) {
+			http.Error(w, "A survey with the same short name or reference already exists", http.StatusConflict)
+			return
+		}
+		logErrorAndRespond(w, "Rename survey failed", http.StatusInternalServerError, err)
+		return
+	}
+
+	version, err := api.bumpSurveyVersion(tx, surveyID)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to update survey version", http.StatusInternalServerError, err)
+		return
+	}
+	after.Version = version
+
+	if err := api.writeAudit(tx, actor, surveyID, auditRenameSurvey, before, after); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey rename", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Survey renamed", zap.String("survey_id", surveyID), zap.String("short_name", after.ShortName), zap.String("survey_ref", after.Reference))
+	writeSurvey(w, &after)
+}
+
+// recordRename keeps the short name and reference a survey had before as aliases if after changes them, so the survey
+// can still be found by them, using transaction tx. Every write which can change a survey's short name or reference
+// goes through it.
+func (api *API) recordRename(tx *sql.Tx, surveyID, actor string, before, after *Survey) *requestError {
+	renames := []struct{ kind, from, to string }{
+		{aliasShortName, before.ShortName, after.ShortName},
+		{aliasRef, before.Reference, after.Reference},
+	}
+	for _, n := range renames {
+		if strings.EqualFold(n.from, n.to) {
+			continue
+		}
+		if reqErr := api.claimAlias(tx, surveyID, n.kind, n.to); reqErr != nil {
+			return reqErr
+		}
+
+		_, err := tx.Stmt(api.CreateSurveyAliasStmt).Exec(surveyID, n.kind, n.from, actor)
+		if isUniqueViolation(err) {
+			return newRequestError(http.StatusConflict, "%v is already an alias of another survey", n.from)
+		} else if err != nil {
+			return newRequestError(http.StatusInternalServerError, "Failed to record survey alias - %v", err)
+		}
+	}
+	return nil
+}
+
+// claimAlias makes sure a survey can take the name alias of the given kind. A name the survey itself used before
+// stops being one of its aliases; a name another survey used before can't be taken.
+func (api *API) claimAlias(tx *sql.Tx, surveyID, kind, alias string) *requestError {
+	var owner string
+	err := tx.Stmt(api.GetSurveyAliasStmt).QueryRow(kind, alias).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return newRequestError(http.StatusInternalServerError, "Failed to check survey aliases - %v", err)
+	}
+
+	if owner != surveyID {
+		return newRequestError(http.StatusConflict, "%v was previously used by another survey", alias)
+	}
+	if _, err := tx.Stmt(api.DeleteSurveyAliasStmt).Exec(surveyID, kind, alias); err != nil {
+		return newRequestError(http.StatusInternalServerError, "Failed to remove survey alias - %v", err)
+	}
+	return nil
+}
+
+// getAliasedSurvey returns the current survey which was previously known by the name alias of the given kind
+func (api *API) getAliasedSurvey(kind, alias string) (*Survey, error) {
+	var surveyID string
+	if err := api.GetSurveyAliasStmt.QueryRow(kind, alias).Scan(&surveyID); err != nil {
+		return nil, err
+	}
+	return api.getSurvey(surveyID)
+}
+
+// writeAliasLink adds a Link header to a response for a survey found by one of its aliases, giving the canonical
+// location of the survey
+func writeAliasLink(w http.ResponseWriter, path string) {
+	w.Header().Set("Link", "<"+path+`>; rel="canonical"`)
+}
+
+// shortNameLocation and refLocation return where a survey can be found by its short name or reference
+func shortNameLocation(survey *Survey) string {
+	return "/surveys/shortname/" + url.PathEscape(survey.ShortName)
+}
+
+func refLocation(survey *Survey) string {
+	return "/surveys/ref/" + url.PathEscape(survey.Reference)
+}
+
+// GetSurveyAliases endpoint handler - returns the short names and references a survey was previously known by
+func (api *API) GetSurveyAliases(w http.ResponseWriter, r *http.Request) {
+	surveyID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := api.getSurveyIncludingArchived(surveyID); err == sql.ErrNoRows {
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logErrorAndRespond(w, "Error getting survey", http.StatusInternalServerError, err)
+		return
+	}
+
+	rows, err := api.GetSurveyAliasesStmt.Query(surveyID)
+	if err != nil {
+		logErrorAndRespond(w, "Get survey aliases query failed", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	aliases := []SurveyAlias{}
+	for rows.Next() {
+		var alias SurveyAlias
+		if err := rows.Scan(&alias.Kind, &alias.Alias, &alias.CreatedBy, &alias.CreatedAt); err != nil {
+			logErrorAndRespond(w, "Failed to get survey aliases", http.StatusInternalServerError, err)
+			return
+		}
+		aliases = append(aliases, alias)
+	}
+	if err := rows.Err(); err != nil {
+		logErrorAndRespond(w, "Failed to get survey aliases", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(aliases); err != nil {
+		logError("Error encoding response to 'get survey aliases'", err)
+	}
+}
+
+// writeSurvey responds with a survey and its current ETag
+func writeSurvey(w http.ResponseWriter, survey *Survey) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", surveyETag(survey.Version))
+	if err := json.NewEncoder(w).Encode(survey); err != nil {
+		logError("Error encoding survey response", err)
+	}
+}
@@ -0,0 +1,159 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRenameSurveySuccess(t *testing.T) {
+	Convey("Survey rename changes the short name and reference and keeps the old ones as aliases", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		surveyRows := sqlmock.NewRows(surveyForUpdateColumns).AddRow(surveyID, "VACS2", "Vacancy Survey", "182", "STA1947", surveyType, "EQ", legalBasisLongName, 7, "LIVE", nil, nil, nil, "{BRES}", nil)
+		mock.ExpectBegin()
+		expectSurveyForUpdate(mock, surveyRows)
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectPrepare("SELECT survey_type, name, json_type, required, allowed_values FROM survey.attribute_definition .+").ExpectQuery().WithArgs(surveyType).WillReturnRows(sqlmock.NewRows([]string{"survey_type", "name", "json_type", "required", "allowed_values"}))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs("VACS3").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs("183").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectPrepare("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").ExpectQuery().WithArgs("SHORT_NAME", "VACS3").WillReturnRows(sqlmock.NewRows([]string{"survey_id"}))
+		mock.ExpectPrepare("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").ExpectQuery().WithArgs("REF", "183").WillReturnRows(sqlmock.NewRows([]string{"survey_id"}).AddRow(surveyID))
+		mock.ExpectPrepare("DELETE FROM survey.survey_alias WHERE survey_id = .+").ExpectExec().WithArgs(surveyID, "REF", "183").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET short_name = .+, survey_ref = .+ WHERE id = .+").ExpectExec().WithArgs(surveyID, "VACS3", "183").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.survey_alias .+").ExpectExec().WithArgs(surveyID, "SHORT_NAME", "VACS2", "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.survey_alias .+").ExpectExec().WithArgs(surveyID, "REF", "182", "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(8))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "RENAME_SURVEY", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/rename"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(`{"shortName": "VACS3", "surveyRef": "183"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"8"`)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.ShortName, ShouldEqual, "VACS3")
+		So(res.Reference, ShouldEqual, "183")
+		So(res.Tags, ShouldResemble, []string{"BRES"})
+	})
+}
+
+func TestRenameSurveyToAnotherSurveysAlias(t *testing.T) {
+	Convey("Survey rename returns a 409 if the new short name was previously used by another survey", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		surveyRows := sqlmock.NewRows(surveyForUpdateColumns).AddRow(surveyID, "VACS2", "Vacancy Survey", "182", "STA1947", surveyType, "EQ", legalBasisLongName, 7, "LIVE", nil, nil, nil, "{BRES}", nil)
+		mock.ExpectBegin()
+		expectSurveyForUpdate(mock, surveyRows)
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectPrepare("SELECT survey_type, name, json_type, required, allowed_values FROM survey.attribute_definition .+").ExpectQuery().WithArgs(surveyType).WillReturnRows(sqlmock.NewRows([]string{"survey_type", "name", "json_type", "required", "allowed_values"}))
+		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs("OLDNAME").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectPrepare("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").ExpectQuery().WithArgs("SHORT_NAME", "OLDNAME").WillReturnRows(sqlmock.NewRows([]string{"survey_id"}).AddRow("0b8d0f7c-0a25-4c3c-9d4b-2ad0d3c0f6a1"))
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/rename"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, strings.NewReader(`{"shortName": "OLDNAME"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusConflict)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, "OLDNAME was previously used by another survey")
+	})
+}
+
+func TestGetSurveyByReferenceAlias(t *testing.T) {
+	Convey("Survey GET by a previous reference returns the survey with a link to its current reference", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectQuery("SELECT id, s.short_name, .+ FROM survey.survey s .+").WithArgs("182").WillReturnRows(sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}))
+		mock.ExpectQuery("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").WithArgs("REF", "182").WillReturnRows(sqlmock.NewRows([]string{"survey_id"}).AddRow(surveyID))
+		mock.ExpectQuery("SELECT id, s.short_name, .+ FROM survey.survey s .+").WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, "VACS3", "Vacancy Survey", "183", "STA1947", surveyType, "EQ", legalBasisLongName, 8, "LIVE", nil, nil, nil, nil, nil))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/ref/182"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("Link"), ShouldEqual, `</surveys/ref/183>; rel="canonical"`)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.ID, ShouldEqual, surveyID)
+		So(res.Reference, ShouldEqual, "183")
+	})
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// The lifecycle states of a survey
+const (
+	surveyStatusDesign    = "DESIGN"
+	surveyStatusLive      = "LIVE"
+	surveyStatusSuspended = "SUSPENDED"
+	surveyStatusRetired   = "RETIRED"
+)
+
+// surveyStatusTransitions maps each status onto the statuses a survey in that status can move to. A retired
+// survey can't be brought back.
+var surveyStatusTransitions = map[string][]string{
+	surveyStatusDesign:    {surveyStatusLive, surveyStatusRetired},
+	surveyStatusLive:      {surveyStatusSuspended, surveyStatusRetired},
+	surveyStatusSuspended: {surveyStatusLive, surveyStatusRetired},
+	surveyStatusRetired:   {},
+}
+
+// SurveyStatusChange represents a request to move a survey to a new status
+type SurveyStatusChange struct {
+	Status string `json:"status"`
+}
+
+// canChangeSurveyStatus returns true if a survey may move from status from to status to
+func canChangeSurveyStatus(from, to string) bool {
+	for _, allowed := range surveyStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSurveyStatuses splits a comma separated list of statuses, returning an error if any of them is unknown. An
+// empty list is returned for an empty value.
+func parseSurveyStatuses(value string) ([]string, error) {
+	statuses := make([]string, 0)
+	if value == "" {
+		return statuses, nil
+	}
+
+	for _, status := range strings.Split(value, ",") {
+		status = strings.ToUpper(strings.TrimSpace(status))
+		if _, ok := surveyStatusTransitions[status]; !ok {
+			return nil, errors.New("status must be one of [DESIGN, LIVE, SUSPENDED, RETIRED]")
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// ChangeSurveyStatus endpoint handler - moves the survey identified by surveyId to the status in the request,
+// provided the transition is allowed from its current status
+func (api *API) ChangeSurveyStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	surveyID := vars["surveyId"]
+	logger.Info("Changing survey status", zap.String("surveyID", surveyID))
+
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ["+surveyID+"] is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading survey status", http.StatusInternalServerError, err)
+		return
+	}
+
+	var change SurveyStatusChange
+	if err := json.Unmarshal(body, &change); err != nil {
+		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := surveyStatusTransitions[change.Status]; !ok {
+		http.Error(w, "status must be one of [DESIGN, LIVE, SUSPENDED, RETIRED]", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// Lock the survey so the transition is checked against the status it's actually moving from
+	before, err := api.getSurveyForUpdate(tx, surveyID)
+	if err == sql.ErrNoRows {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error retrieving survey by survey ID", http.StatusInternalServerError, err)
+		return
+	}
+
+	if !canChangeSurveyStatus(before.Status, change.Status) {
+		rollBack(tx)
+		http.Error(w, "A survey cannot move from "+before.Status+" to "+change.Status, http.StatusConflict)
+		return
+	}
+
+	if err := api.checkIfMatch(tx, surveyID, r.Header.Get("If-Match")); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	if _, err := tx.Stmt(api.UpdateSurveyStatusStmt).Exec(surveyID, change.Status); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Update survey status query failed", http.StatusInternalServerError, err)
+		return
+	}
+
+	version, err := api.bumpSurveyVersion(tx, surveyID)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to update survey version", http.StatusInternalServerError, err)
+		return
+	}
+
+	// The survey is returned in the same format as GET /surveys/{surveyId}, with its tags and owner
+	changed := *before
+	changed.Status = change.Status
+	if err := api.writeAudit(tx, requestActor(r), surveyID, auditChangeStatus, before, changed); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey status change", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Successfully changed survey status", zap.String("surveyID", surveyID), zap.String("status", change.Status))
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", surveyETag(version))
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(changed); err != nil {
+		logError("Error encoding response to 'change survey status'", err)
+	}
+}
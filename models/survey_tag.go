@@ -0,0 +1,193 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// How GET /surveys matches surveys against more than one tag
+const (
+	tagMatchAll = "all"
+	tagMatchAny = "any"
+)
+
+// Tags are lower case so they can be compared as they're stored. Spaces, hyphens and underscores are allowed between
+// letters and digits, e.g. "short-term indicators".
+var validTag = regexp.MustCompile(`^[a-z0-9]([a-z0-9 _-]{0,48}[a-z0-9])?$`)
+
+// TagUsage represents a tag and how many current surveys have it
+type TagUsage struct {
+	Tag         string `json:"tag"`
+	SurveyCount int    `json:"surveyCount"`
+}
+
+// normaliseTag returns the form a tag is stored and compared in
+func normaliseTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// parseTags normalises and checks the tags given to GET /surveys, dropping any given twice
+func parseTags(values []string) ([]string, error) {
+	seen := map[string]bool{}
+	var tags []string
+	for _, v := range values {
+		tag := normaliseTag(v)
+		if !validTag.MatchString(tag) {
+			return nil, errors.Errorf("'%s' is not a valid tag", v)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// AddSurveyTag endpoint handler - tags the survey identified by surveyId
+func (api *API) AddSurveyTag(w http.ResponseWriter, r *http.Request) {
+	api.changeSurveyTag(w, r, auditAddTag)
+}
+
+// RemoveSurveyTag endpoint handler - removes a tag from the survey identified by surveyId
+func (api *API) RemoveSurveyTag(w http.ResponseWriter, r *http.Request) {
+	api.changeSurveyTag(w, r, auditRemoveTag)
+}
+
+// changeSurveyTag adds or removes the tag in the request path, depending on operation, and responds with the survey
+func (api *API) changeSurveyTag(w http.ResponseWriter, r *http.Request, operation string) {
+	vars := mux.Vars(r)
+	surveyID := vars["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	tag := normaliseTag(vars["tag"])
+	if !validTag.MatchString(tag) {
+		http.Error(w, "Tags must be 1 to 50 letters, digits, spaces, hyphens or underscores, starting and ending with a letter or digit", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// The survey is locked so that concurrent changes to its tags are applied one after the other
+	before, err := api.getSurveyForUpdate(tx, surveyID)
+	if err == sql.ErrNoRows {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error getting survey to tag", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := api.checkIfMatch(tx, surveyID, r.Header.Get("If-Match")); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	tagged := false
+	after := *before
+	after.Tags = nil
+	for _, t := range before.Tags {
+		if t == tag {
+			tagged = true
+		} else {
+			after.Tags = append(after.Tags, t)
+		}
+	}
+
+	if operation == auditRemoveTag && !tagged {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey tag not found", http.StatusNotFound)
+		return
+	}
+
+	// Adding a tag the survey already has changes nothing
+	if operation == auditAddTag && tagged {
+		rollBack(tx)
+		writeSurvey(w, before)
+		return
+	}
+
+	actor := requestActor(r)
+	if operation == auditAddTag {
+		_, err = tx.Stmt(api.CreateSurveyTagStmt).Exec(surveyID, tag, actor)
+		after.Tags = append(append([]string(nil), before.Tags...), tag)
+		sort.Strings(after.Tags)
+	} else {
+		_, err = tx.Stmt(api.DeleteSurveyTagStmt).Exec(surveyID, tag)
+	}
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to change survey tags", http.StatusInternalServerError, err)
+		return
+	}
+
+	version, err := api.bumpSurveyVersion(tx, surveyID)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to update survey version", http.StatusInternalServerError, err)
+		return
+	}
+	after.Version = version
+
+	if err := api.writeAudit(tx, actor, surveyID, operation, before, &after); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey tags", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Survey tags changed", zap.String("survey_id", surveyID), zap.String("operation", operation), zap.String("tag", tag))
+	writeSurvey(w, &after)
+}
+
+// AllTags endpoint handler - returns every tag used by a current survey with the number of surveys using it
+func (api *API) AllTags(w http.ResponseWriter, r *http.Request) {
+	rows, err := api.GetTagUsageStmt.Query()
+	if err != nil {
+		logErrorAndRespond(w, "Get tags query failed", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	tags := []TagUsage{}
+	for rows.Next() {
+		var tag TagUsage
+		if err := rows.Scan(&tag.Tag, &tag.SurveyCount); err != nil {
+			logErrorAndRespond(w, "Failed to get tags", http.StatusInternalServerError, err)
+			return
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		logErrorAndRespond(w, "Failed to get tags", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(tags); err != nil {
+		logError("Error encoding response to 'get tags'", err)
+	}
+}
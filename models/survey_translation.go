@@ -0,0 +1,371 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	validator2 "gopkg.in/go-playground/validator.v9"
+)
+
+// defaultLocale is the language surveys are created in. Display text in other languages is held as translations.
+const defaultLocale = "en"
+
+// translationLocales are the locales survey display text can be translated into
+var translationLocales = map[string]bool{"cy": true}
+
+// SurveyTranslation holds the display text of a survey in a language other than English. Text which isn't
+// translated is shown in English.
+type SurveyTranslation struct {
+	LongName   string `json:"longName,omitempty" validate:"max=100"`
+	LegalBasis string `json:"legalBasis,omitempty" validate:"max=400"`
+}
+
+// fields maps the names translated text is stored under onto the text
+func (t *SurveyTranslation) fields() map[string]*string {
+	return map[string]*string{"long_name": &t.LongName, "legal_basis": &t.LegalBasis}
+}
+
+// negotiateLocale returns the locale the Accept-Language header prefers, out of English and the locales surveys can be
+// translated into. English is returned if the header prefers none of them.
+func negotiateLocale(header string) string {
+	best, bestQ := defaultLocale, 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, q := part, 1.0
+		if i := strings.Index(part, ";"); i >= 0 {
+			tag = part[:i]
+			if param := strings.TrimSpace(part[i+1:]); strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		// Regional variants, e.g. cy-GB, are served the language's translation
+		locale := strings.ToLower(strings.SplitN(strings.TrimSpace(tag), "-", 2)[0])
+		if (locale == defaultLocale || translationLocales[locale]) && q > bestQ {
+			best, bestQ = locale, q
+		}
+	}
+	return best
+}
+
+// readTranslations returns the translations in rows by survey id and locale
+func readTranslations(rows *sql.Rows) (map[string]map[string]SurveyTranslation, error) {
+	defer rows.Close()
+
+	translations := map[string]map[string]SurveyTranslation{}
+	for rows.Next() {
+		var surveyID, locale, field, value string
+		if err := rows.Scan(&surveyID, &locale, &field, &value); err != nil {
+			return nil, err
+		}
+
+		if translations[surveyID] == nil {
+			translations[surveyID] = map[string]SurveyTranslation{}
+		}
+		translation := translations[surveyID][locale]
+		if text, ok := translation.fields()[field]; ok {
+			*text = value
+		}
+		translations[surveyID][locale] = translation
+	}
+	return translations, rows.Err()
+}
+
+// getTranslations returns the translations of the given surveys by survey id and locale
+func (api *API) getTranslations(surveys []*Survey) (map[string]map[string]SurveyTranslation, error) {
+	ids := make([]string, len(surveys))
+	for i, s := range surveys {
+		ids[i] = s.ID
+	}
+
+	rows, err := api.GetSurveyTranslationsStmt.Query(pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	return readTranslations(rows)
+}
+
+// allLocalesVariant is the representation variant of surveys shown with every translation
+const allLocalesVariant = "all"
+
+// localiseSurveys shows surveys in the language asked for by the request's Accept-Language header, falling back to
+// English for any text which isn't translated, and sets Content-Language. With allLocales=true the surveys are left
+// in English with every translation added instead. The language chosen, or allLocalesVariant, is returned so it can
+// be added to the entity tag. An error response is written and false returned if the surveys can't be localised.
+func (api *API) localiseSurveys(w http.ResponseWriter, r *http.Request, surveys ...*Survey) (string, bool) {
+	w.Header().Add("Vary", "Accept-Language")
+
+	allLocales := false
+	if v := r.URL.Query().Get("allLocales"); v != "" {
+		var err error
+		if allLocales, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "allLocales must be true or false", http.StatusBadRequest)
+			return "", false
+		}
+	}
+
+	locale := negotiateLocale(r.Header.Get("Accept-Language"))
+	variant := locale
+	if allLocales {
+		variant = allLocalesVariant
+	}
+	if len(surveys) == 0 || (locale == defaultLocale && !allLocales) {
+		w.Header().Set("Content-Language", defaultLocale)
+		return variant, true
+	}
+
+	translations, err := api.getTranslations(surveys)
+	if err != nil {
+		logErrorAndRespond(w, "Error getting survey translations", http.StatusInternalServerError, err)
+		return "", false
+	}
+
+	translated := false
+	for _, s := range surveys {
+		if allLocales {
+			s.Translations = translations[s.ID]
+			continue
+		}
+
+		translation, ok := translations[s.ID][locale]
+		if !ok {
+			continue
+		}
+		if translation.LongName != "" {
+			s.LongName = translation.LongName
+			translated = true
+		}
+		if translation.LegalBasis != "" {
+			s.LegalBasis = translation.LegalBasis
+			translated = true
+		}
+	}
+
+	if translated {
+		w.Header().Set("Content-Language", locale)
+	} else {
+		w.Header().Set("Content-Language", defaultLocale)
+	}
+	return variant, true
+}
+
+// AllSurveyTranslations endpoint handler - returns the translations of the survey identified by surveyId by locale
+func (api *API) AllSurveyTranslations(w http.ResponseWriter, r *http.Request) {
+	surveyID := mux.Vars(r)["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	survey, err := api.getSurvey(surveyID)
+	if err == sql.ErrNoRows {
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logErrorAndRespond(w, "Error getting survey to translate", http.StatusInternalServerError, err)
+		return
+	}
+
+	translations, err := api.getTranslations([]*Survey{survey})
+	if err != nil {
+		logErrorAndRespond(w, "Error getting survey translations", http.StatusInternalServerError, err)
+		return
+	}
+
+	byLocale := translations[surveyID]
+	if byLocale == nil {
+		byLocale = map[string]SurveyTranslation{}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", surveyETag(survey.Version))
+	if err := json.NewEncoder(w).Encode(byLocale); err != nil {
+		logError("Error encoding response to 'get survey translations'", err)
+	}
+}
+
+// PutSurveyTranslation endpoint handler - sets, or replaces, the translation of a survey's display text into a locale
+func (api *API) PutSurveyTranslation(w http.ResponseWriter, r *http.Request) {
+	surveyID, locale, ok := translationPath(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading request body", http.StatusInternalServerError, err)
+		return
+	}
+
+	translation := new(SurveyTranslation)
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(translation); err != nil {
+		http.Error(w, "Error unmarshalling JSON - only longName and legalBasis can be translated", http.StatusBadRequest)
+		return
+	}
+
+	if *translation == (SurveyTranslation{}) {
+		http.Error(w, "At least one of longName and legalBasis must be given", http.StatusBadRequest)
+		return
+	}
+
+	if err := api.Validator.Struct(translation); err != nil {
+		validationErrors, ok := err.(validator2.ValidationErrors)
+		if !ok {
+			logErrorAndRespond(w, "Error validating survey translation", http.StatusInternalServerError, err)
+			return
+		}
+		fe := validationErrors[0]
+		http.Error(w, fmt.Sprintf("%s: %s", surveyJSONField(fe.StructField()), validationMessage(fe)), http.StatusBadRequest)
+		return
+	}
+
+	api.changeSurveyTranslation(w, r, surveyID, locale, translation)
+}
+
+// DeleteSurveyTranslation endpoint handler - removes the translation of a survey's display text into a locale
+func (api *API) DeleteSurveyTranslation(w http.ResponseWriter, r *http.Request) {
+	surveyID, locale, ok := translationPath(w, r)
+	if !ok {
+		return
+	}
+
+	api.changeSurveyTranslation(w, r, surveyID, locale, nil)
+}
+
+// translationPath returns the survey id and locale in the request path, or writes a 400 response and returns false
+// if either is invalid
+func translationPath(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	vars := mux.Vars(r)
+	surveyID := vars["surveyId"]
+	if _, err := uuid.FromString(surveyID); err != nil {
+		http.Error(w, "The value ("+surveyID+") used for surveyId is not a valid UUID", http.StatusBadRequest)
+		return "", "", false
+	}
+
+	locale := strings.ToLower(vars["locale"])
+	if !translationLocales[locale] {
+		locales := make([]string, 0, len(translationLocales))
+		for l := range translationLocales {
+			locales = append(locales, l)
+		}
+		sort.Strings(locales)
+		http.Error(w, "Locale must be one of ["+strings.Join(locales, ", ")+"]", http.StatusBadRequest)
+		return "", "", false
+	}
+	return surveyID, locale, true
+}
+
+// changeSurveyTranslation replaces the translation of a survey into locale, or removes it if translation is nil, in
+// a transaction which checks the survey exists and matches If-Match, bumps its version and audits the change
+func (api *API) changeSurveyTranslation(w http.ResponseWriter, r *http.Request, surveyID, locale string, translation *SurveyTranslation) {
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	before, err := api.getSurveySnapshot(tx, surveyID)
+	if err == nil {
+		var rows *sql.Rows
+		if rows, err = tx.Stmt(api.GetSurveyTranslationsStmt).Query(pq.Array([]string{surveyID})); err == nil {
+			var translations map[string]map[string]SurveyTranslation
+			translations, err = readTranslations(rows)
+			before.Translations = translations[surveyID]
+		}
+	}
+	if err == sql.ErrNoRows || (err == nil && before.ArchivedAt != nil) {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error getting survey to translate", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := api.checkIfMatch(tx, surveyID, r.Header.Get("If-Match")); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	if _, ok := before.Translations[locale]; translation == nil && !ok {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey translation not found", http.StatusNotFound)
+		return
+	}
+
+	actor := requestActor(r)
+	_, err = tx.Stmt(api.DeleteSurveyTranslationsStmt).Exec(surveyID, locale)
+	if translation != nil {
+		for field, text := range translation.fields() {
+			if err != nil || *text == "" {
+				continue
+			}
+			_, err = tx.Stmt(api.CreateSurveyTranslationStmt).Exec(surveyID, locale, field, *text, actor)
+		}
+	}
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to change survey translation", http.StatusInternalServerError, err)
+		return
+	}
+
+	version, err := api.bumpSurveyVersion(tx, surveyID)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to update survey version", http.StatusInternalServerError, err)
+		return
+	}
+
+	after := *before
+	after.Version = version
+	after.Translations = map[string]SurveyTranslation{}
+	for l, t := range before.Translations {
+		if l != locale {
+			after.Translations[l] = t
+		}
+	}
+	if translation != nil {
+		after.Translations[locale] = *translation
+	}
+
+	if err := api.writeAudit(tx, actor, surveyID, auditTranslateSurvey, before, &after); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey translation", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Survey translation changed", zap.String("survey_id", surveyID), zap.String("locale", locale), zap.Bool("removed", translation == nil))
+	w.Header().Set("ETag", surveyETag(version))
+	if translation == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Content-Language", locale)
+	if err := json.NewEncoder(w).Encode(translation); err != nil {
+		logError("Error encoding response to 'put survey translation'", err)
+	}
+}
@@ -0,0 +1,201 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const welshLongName = "Arolwg Cofrestr Busnes a Chyflogaeth"
+
+var translationColumns = []string{"survey_id", "locale", "field", "value"}
+
+func TestSurveyGetHonoursAcceptLanguage(t *testing.T) {
+	Convey("Survey GET returns the Welsh text of a survey asked for in Welsh, falling back to English", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, 1, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ WHERE id = ?").ExpectQuery().WithArgs(surveyID).WillReturnRows(rows)
+		mock.ExpectQuery("SELECT survey_id, locale, field, value FROM survey.survey_translation .+").WithArgs(sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(translationColumns).AddRow(surveyID, "cy", "long_name", welshLongName))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Accept-Language", "cy-GB, en;q=0.8")
+		// The English representation of the same version mustn't satisfy a request for Welsh
+		r.Header.Set("If-None-Match", `"1"`)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"1-cy"`)
+		So(resp.Header.Get("Content-Language"), ShouldEqual, "cy")
+		So(resp.Header.Get("Vary"), ShouldEqual, "Accept-Language")
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.LongName, ShouldEqual, welshLongName)
+		So(res.LegalBasis, ShouldEqual, legalBasisLongName)
+		So(res.Translations, ShouldBeNil)
+	})
+}
+
+func TestSurveyListAllLocales(t *testing.T) {
+	Convey("Surveys list with allLocales=true returns the surveys in English with their translations", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
+		mock.ExpectQuery("SELECT survey_id, locale, field, value FROM survey.survey_translation .+").WithArgs(sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(translationColumns).AddRow(surveyID, "cy", "long_name", welshLongName))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys?allLocales=true"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("GET", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("Content-Language"), ShouldEqual, "en")
+		var res []models.Survey
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res, ShouldHaveLength, 1)
+		So(res[0].LongName, ShouldEqual, longName)
+		So(res[0].Translations, ShouldResemble, map[string]models.SurveyTranslation{"cy": {LongName: welshLongName}})
+	})
+}
+
+func TestPutSurveyTranslation(t *testing.T) {
+	Convey("Survey translation PUT replaces the survey's text in the locale and returns it, accepting an If-Match from a localised GET", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT id, s.short_name, .+, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows(snapshotColumns).AddRow(surveyID, shortName, longName, reference, "STA1947", surveyType, surveyMode, legalBasisLongName, nil, 3, "LIVE", nil, nil, nil))
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}))
+		mock.ExpectPrepare("SELECT survey_id, locale, field, value FROM survey.survey_translation .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(translationColumns).AddRow(surveyID, "cy", "long_name", "Hen enw"))
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectPrepare("DELETE FROM survey.survey_translation .+").ExpectExec().WithArgs(surveyID, "cy").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.survey_translation .+").ExpectExec().WithArgs(surveyID, "cy", "long_name", welshLongName, "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "TRANSLATE_SURVEY", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/translations/cy"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("PUT", url, strings.NewReader(`{"longName": "`+welshLongName+`"}`))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("If-Match", `"3-cy"`)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"4"`)
+		So(resp.Header.Get("Content-Language"), ShouldEqual, "cy")
+		res := models.SurveyTranslation{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res, ShouldResemble, models.SurveyTranslation{LongName: welshLongName})
+	})
+}
+
+func TestPutSurveyTranslationInvalid(t *testing.T) {
+	Convey("Survey translation PUT returns a 400 for an unsupported locale or untranslatable text", t, func() {
+		for _, c := range []struct{ locale, payload string }{
+			{"fr", `{"longName": "Enquête"}`},
+			{"cy", `{"shortName": "BRES"}`},
+			{"cy", `{}`},
+		} {
+			db, mock, err := sqlmock.New()
+			So(err, ShouldBeNil)
+			prepareMockStmts(mock)
+			db.Begin()
+
+			// When
+			api, err := models.NewAPI(db)
+			So(err, ShouldBeNil)
+
+			// Create a new router and plug in the defined routes
+			router := mux.NewRouter()
+			models.SetUpRoutes(router, api)
+
+			ts := httptest.NewServer(router)
+			url := ts.URL + "/surveys/" + surveyID + "/translations/" + c.locale
+			// User and password not set so base64encode the dividing character
+			basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+			r, err := http.NewRequest("PUT", url, strings.NewReader(c.payload))
+			r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+			resp, err := httpClient.Do(r)
+			So(err, ShouldBeNil)
+
+			// Then
+			So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+
+			ts.Close()
+			api.Close()
+			db.Close()
+		}
+	})
+}
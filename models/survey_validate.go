@@ -0,0 +1,296 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	validator2 "gopkg.in/go-playground/validator.v9"
+)
+
+// FieldError is a problem with one field of a survey payload
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// SurveyValidation is the result of checking a survey payload without creating the survey
+type SurveyValidation struct {
+	Valid  bool         `json:"valid"`
+	Errors []FieldError `json:"errors"`
+}
+
+// ValidateSurvey endpoint handler - runs the checks PostSurveyDetails makes on a new survey and reports all the
+// problems found, without creating the survey
+func (api *API) ValidateSurvey(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logErrorAndRespond(w, "Error reading request body", http.StatusInternalServerError, err)
+		return
+	}
+
+	var survey Survey
+	if err := json.Unmarshal(body, &survey); err != nil {
+		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
+	}
+
+	_, problems, err := api.checkSurvey(&survey, "")
+	if err != nil {
+		logErrorAndRespond(w, "Error validating survey", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err := json.NewEncoder(w).Encode(SurveyValidation{Valid: len(problems) == 0, Errors: problems.fieldErrors()}); err != nil {
+		logError("Error encoding response to 'validate survey'", err)
+	}
+}
+
+// surveyProblem is a problem checkSurvey found with a survey. status is the HTTP status code a request which stops at
+// the problem responds with, and detail the message it responds with if that isn't Message. classifier is set for
+// problems with one of the survey's classifiers.
+type surveyProblem struct {
+	FieldError
+	status     int
+	detail     string
+	classifier *ClassifierRejection
+}
+
+// surveyProblems are the problems checkSurvey found with a survey, in the order they were found
+type surveyProblems []surveyProblem
+
+// fieldErrors returns the problems as they're reported by requests which report every problem
+func (p surveyProblems) fieldErrors() []FieldError {
+	fieldErrors := make([]FieldError, len(p))
+	for i, problem := range p {
+		fieldErrors[i] = problem.FieldError
+	}
+	return fieldErrors
+}
+
+// first returns the first problem as it's reported by requests which stop at the first problem, or nil if there are
+// none
+func (p surveyProblems) first() *requestError {
+	if len(p) == 0 {
+		return nil
+	}
+	message := p[0].detail
+	if message == "" {
+		message = p[0].Message
+	}
+	return &requestError{status: p[0].status, message: message}
+}
+
+// writeSurveyProblems responds to a request which stops at the first problem found with a survey. Problems with its
+// classifiers are reported together, as every classifier is checked before any of them are written.
+func writeSurveyProblems(w http.ResponseWriter, problems surveyProblems) {
+	first := problems[0]
+	if first.classifier == nil {
+		reqErr := problems.first()
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+
+	rejections := []ClassifierRejection{}
+	for _, p := range problems {
+		if p.classifier != nil && p.status == first.status {
+			rejections = append(rejections, *p.classifier)
+		}
+	}
+	message := "Survey classifiers failed to validate"
+	if first.status == http.StatusConflict {
+		message = "Survey classifiers already exist"
+	}
+	writeClassifierRejections(w, first.status, message, rejections)
+}
+
+// checkSurvey runs the checks a survey must pass before it is written to the database, carrying on past the first
+// problem so every one is returned along with the survey's resolved legal basis. currentRef is the reference of the
+// survey being updated, or empty for a new survey, so that a survey doesn't clash with itself when checking the short
+// name and reference are unique. The id, classifier type selector ids, tags, owner, translations and external ids are
+// only checked for new surveys. An error is only returned if a check couldn't be made.
+func (api *API) checkSurvey(survey *Survey, currentRef string) (LegalBasis, surveyProblems, error) {
+	var legalBasis LegalBasis
+	var err error
+	newSurvey := currentRef == ""
+	problems := surveyProblems{}
+	reject := func(status int, field, format string, a ...interface{}) *surveyProblem {
+		problems = append(problems, surveyProblem{FieldError: FieldError{Field: field, Message: fmt.Sprintf(format, a...)}, status: status})
+		return &problems[len(problems)-1]
+	}
+
+	if err := api.Validator.Struct(survey); err != nil {
+		validationErrors, ok := err.(validator2.ValidationErrors)
+		if !ok {
+			return legalBasis, nil, err
+		}
+		for _, fe := range validationErrors {
+			reject(http.StatusBadRequest, surveyJSONField(fe.StructField()), "%s", validationMessage(fe)).detail = "Survey failed to validate - " + err.Error()
+		}
+	}
+
+	if newSurvey && survey.ID != "" {
+		if _, err := uuid.FromString(survey.ID); err != nil {
+			reject(http.StatusBadRequest, "id", "The value (%v) used for id is not a valid UUID", survey.ID)
+		} else if exists, err := api.surveyIDExists(survey.ID); err != nil {
+			return legalBasis, nil, err
+		} else if exists {
+			reject(http.StatusConflict, "id", "Survey with id %v already exists", survey.ID)
+		}
+	}
+
+	// These have their own endpoints, which take them once the survey is created, rather than being dropped
+	if newSurvey {
+		if len(survey.Tags) > 0 {
+			reject(http.StatusBadRequest, "tags", "The tags of a survey are added with PUT /surveys/{surveyId}/tags/{tag} once it's created")
+		}
+		if survey.Owner != nil {
+			reject(http.StatusBadRequest, "owner", "The owner of a survey is set with PUT /surveys/{surveyId}/owner once it's created")
+		}
+		if len(survey.Translations) > 0 {
+			reject(http.StatusBadRequest, "translations", "The translations of a survey are added with PUT /surveys/{surveyId}/translations/{locale} once it's created")
+		}
+		if len(survey.ExternalIDs) > 0 {
+			reject(http.StatusBadRequest, "externalIds", "The external identifiers of a survey are added with PUT /surveys/{surveyId}/externalids/{system} once it's created")
+		}
+	}
+
+	if survey.LegalBasisRef != "" {
+		if legalBasis, err = api.getLegalBasisFromRef(survey.LegalBasisRef); err == sql.ErrNoRows {
+			reject(http.StatusBadRequest, "legalBasisRef", "Legal basis with reference %v does not exist", survey.LegalBasisRef)
+		} else if err != nil {
+			return legalBasis, nil, err
+		}
+	} else if survey.LegalBasis != "" {
+		if legalBasis, err = api.getLegalBasisFromLongName(survey.LegalBasis); err == sql.ErrNoRows {
+			reject(http.StatusBadRequest, "legalBasis", "Legal basis %v does not exist", survey.LegalBasis)
+		} else if err != nil {
+			return legalBasis, nil, err
+		}
+	} else {
+		reject(http.StatusBadRequest, "legalBasis", "No legal basis specified for survey")
+	}
+
+	if !validSurveyTypes[survey.SurveyType] {
+		reject(http.StatusBadRequest, "surveyType", "Survey type must be one of [Census, Business, Social]")
+	}
+
+	if !validSurveyModes[survey.SurveyMode] {
+		reject(http.StatusBadRequest, "surveyMode", "Survey mode must be one of [EQ, SEFT, EQ_AND_SEFT]")
+	}
+
+	if field, message := checkPeriodicity(survey); message != "" {
+		reject(http.StatusBadRequest, field, "%s", message)
+	}
+
+	if validSurveyTypes[survey.SurveyType] {
+		definitions, err := api.getAttributeDefinitions(survey.SurveyType)
+		if err != nil {
+			return legalBasis, nil, err
+		}
+		for _, problem := range checkAttributes(survey.SurveyType, survey.Attributes, definitions) {
+			reject(http.StatusBadRequest, attributeQueryPrefix+problem.name, "%s", problem.message)
+		}
+	}
+
+	// Archived surveys keep their short name and reference so they can be restored
+	if survey.ShortName != "" {
+		if ref, err := api.getSurveyByShortname(survey.ShortName); err == nil && (newSurvey || !strings.EqualFold(ref, currentRef)) {
+			reject(http.StatusConflict, "shortName", "The survey with Abbreviation %v already exists", survey.ShortName)
+		} else if err != nil && err != sql.ErrNoRows {
+			return legalBasis, nil, err
+		}
+	}
+
+	// The reference of an existing survey only needs to be checked if it's being changed
+	if survey.Reference != "" && (newSurvey || !strings.EqualFold(survey.Reference, currentRef)) {
+		if err := api.getSurveyRef(survey.Reference); err == nil {
+			reject(http.StatusConflict, "surveyRef", "Survey with reference %v already exists", survey.Reference)
+		} else if err != sql.ErrNoRows {
+			return legalBasis, nil, err
+		}
+	}
+
+	// A name another survey was previously known by still finds that survey, so it can't be taken
+	aliases := []struct{ kind, field, name string }{
+		{aliasShortName, "shortName", survey.ShortName},
+		{aliasRef, "surveyRef", survey.Reference},
+	}
+	for _, a := range aliases {
+		if a.name == "" {
+			continue
+		}
+		var owner string
+		if err := api.GetSurveyAliasStmt.QueryRow(a.kind, a.name).Scan(&owner); err == nil && !strings.EqualFold(owner, survey.ID) {
+			reject(http.StatusConflict, a.field, "%v was previously used by another survey", a.name)
+		} else if err != nil && err != sql.ErrNoRows {
+			return legalBasis, nil, err
+		}
+	}
+
+	rejectClassifier := func(status int, rejection ClassifierRejection) {
+		field := fmt.Sprintf("classifiers[%d]", rejection.Index)
+		if rejection.ClassifierType != "" {
+			field += ".classifierTypes"
+		}
+		reject(status, field, "%s", rejection.Reason).classifier = &rejection
+	}
+	for _, rejection := range api.checkClassifiers(survey.Classifiers) {
+		rejectClassifier(http.StatusBadRequest, rejection)
+	}
+	if newSurvey {
+		existing, err := api.checkClassifierIDsUnused(survey.Classifiers)
+		if err != nil {
+			return legalBasis, nil, err
+		}
+		for _, rejection := range existing {
+			rejectClassifier(http.StatusConflict, rejection)
+		}
+	}
+
+	return legalBasis, problems, nil
+}
+
+// firstSurveyProblem runs checkSurvey for requests which stop at the first problem with a survey, returning it, or
+// the error if a check couldn't be made, as a requestError
+func (api *API) firstSurveyProblem(survey *Survey, currentRef string) (LegalBasis, *requestError) {
+	legalBasis, problems, err := api.checkSurvey(survey, currentRef)
+	if err != nil {
+		logError("Error validating survey", err)
+		return legalBasis, newRequestError(http.StatusInternalServerError, "Error validating survey")
+	}
+	return legalBasis, problems.first()
+}
+
+// surveyJSONField returns the name a field of Survey has in JSON
+func surveyJSONField(structField string) string {
+	if f, ok := reflect.TypeOf(Survey{}).FieldByName(structField); ok {
+		if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" {
+			return name
+		}
+	}
+	return structField
+}
+
+// validationMessage describes a failed Validator rule
+func validationMessage(fe validator2.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "Value is required"
+	case "max":
+		return "Value must be at most " + fe.Param() + " characters"
+	case "no-spaces":
+		return "Value must not contain spaces"
+	case "email":
+		return "Value must be an email address"
+	case "phone":
+		return "Value must be a phone number"
+	}
+	return "Value failed the " + fe.Tag() + " rule"
+}
@@ -0,0 +1,157 @@
+package models_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ONSdigital/rm-survey-service/models"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateSurveyValid(t *testing.T) {
+	Convey("Survey validate reports a survey which could be created as valid", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys:validate"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "` + reference + `", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "SEFT",
+			"classifiers": [{"name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE"]}]}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.SurveyValidation{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Valid, ShouldBeTrue)
+		So(res.Errors, ShouldBeEmpty)
+	})
+}
+
+func TestValidateSurveyReportsAnotherSurveysAlias(t *testing.T) {
+	Convey("Survey validate reports a short name another survey was previously known by", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("STA1947").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", legalBasisLongName))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").WithArgs("SHORT_NAME", shortName).WillReturnRows(sqlmock.NewRows([]string{"survey_id"}).AddRow("0b8d0f7c-0a25-4c3c-9d4b-2ad0d3c0f6a1"))
+		mock.ExpectQuery("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").WithArgs("REF", reference).WillReturnRows(sqlmock.NewRows([]string{"survey_id"}))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys:validate"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"shortName": "` + shortName + `", "longName": "` + longName + `", "surveyRef": "` + reference + `", "legalBasisRef": "STA1947", "surveyType": "Business", "surveyMode": "SEFT"}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.SurveyValidation{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Valid, ShouldBeFalse)
+		So(res.Errors, ShouldResemble, []models.FieldError{{Field: "shortName", Message: shortName + " was previously used by another survey"}})
+	})
+}
+
+func TestValidateSurveyReportsEveryProblem(t *testing.T) {
+	Convey("Survey validate reports every problem with a survey rather than just the first", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		mock.ExpectQuery("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").WithArgs("NOPE").WillReturnRows(sqlmock.NewRows([]string{"ref", "long_name"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs("test shortname").WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").WithArgs(reference).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}).AddRow(reference))
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys:validate"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		payload := `{"shortName": "test shortname", "surveyRef": "` + reference + `", "legalBasisRef": "NOPE", "surveyType": "Invalid", "surveyMode": "SEFT",
+			"classifiers": [{"name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE"]}, {"name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE"]}]}`
+		r, err := http.NewRequest("POST", url, strings.NewReader(payload))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		res := models.SurveyValidation{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Valid, ShouldBeFalse)
+		So(res.Errors, ShouldResemble, []models.FieldError{
+			{Field: "shortName", Message: "Value must not contain spaces"},
+			{Field: "longName", Message: "Value is required"},
+			{Field: "legalBasisRef", Message: "Legal basis with reference NOPE does not exist"},
+			{Field: "surveyType", Message: "Survey type must be one of [Census, Business, Social]"},
+			{Field: "surveyRef", Message: "Survey with reference " + reference + " already exists"},
+			{Field: "classifiers[1]", Message: "Classifier type selector is given more than once"},
+		})
+	})
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/blendle/zapdriver"
 	"github.com/gofrs/uuid"
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	validator2 "gopkg.in/go-playground/validator.v9"
@@ -39,17 +40,37 @@ type ClassifierTypeSelector struct {
 
 // Survey represents the details of a survey.
 type Survey struct {
-	ID            string                   `json:"id"`
-	ShortName     string                   `json:"shortName" validate:"required,no-spaces,max=20"`
-	LongName      string                   `json:"longName" validate:"required,max=100"`
-	Reference     string                   `json:"surveyRef" validate:"required,max=20"`
-	LegalBasis    string                   `json:"legalBasis"`
-	SurveyType    string                   `json:"surveyType"`
-	SurveyMode    string                   `json:"surveyMode"`
-	LegalBasisRef string                   `json:"legalBasisRef"`
-	Classifiers   []ClassifierTypeSelector `json:"classifiers,omitempty"`
+	ID            string                       `json:"id"`
+	ShortName     string                       `json:"shortName" validate:"required,no-spaces,max=20"`
+	LongName      string                       `json:"longName" validate:"required,max=100"`
+	Reference     string                       `json:"surveyRef" validate:"required,max=20"`
+	LegalBasis    string                       `json:"legalBasis"`
+	SurveyType    string                       `json:"surveyType"`
+	SurveyMode    string                       `json:"surveyMode"`
+	LegalBasisRef string                       `json:"legalBasisRef"`
+	Status        string                       `json:"status"`
+	Periodicity   *string                      `json:"periodicity"`
+	PeriodFormat  *string                      `json:"periodFormat"`
+	Attributes    SurveyAttributes             `json:"attributes,omitempty"`
+	Tags          []string                     `json:"tags,omitempty"`
+	Owner         *SurveyOwner                 `json:"owner,omitempty"`
+	Translations  map[string]SurveyTranslation `json:"translations,omitempty"`
+	ExternalIDs   []ExternalID                 `json:"externalIds,omitempty"`
+	Classifiers   []ClassifierTypeSelector     `json:"classifiers,omitempty"`
+	ArchivedAt    *time.Time                   `json:"archivedAt,omitempty"`
+	Version       int                          `json:"-"`
 }
 
+// surveyTypes maps lower case survey types onto the values of the survey_type enumeration
+var surveyTypes = map[string]string{
+	"business": "Business",
+	"social":   "Social",
+	"census":   "Census",
+}
+
+// validSurveyTypes are the survey types a survey can be created with
+var validSurveyTypes = map[string]bool{"Census": true, "Business": true, "Social": true}
+
 // LegalBasis - the legal basis for a survey consisting of a short reference and a long name
 type LegalBasis struct {
 	Reference string `json:"ref"`
@@ -58,28 +79,86 @@ type LegalBasis struct {
 
 // API contains all the pre-prepared sql statements
 type API struct {
-	AllSurveysStmt                         *sql.Stmt
 	GetSurveysBySurveyTypeStmt             *sql.Stmt
 	GetSurveyStmt                          *sql.Stmt
+	GetSurveyIncludingArchivedStmt         *sql.Stmt
 	DeleteSurveyByIDStmt                   *sql.Stmt
+	ArchiveSurveyStmt                      *sql.Stmt
+	RestoreSurveyStmt                      *sql.Stmt
+	UpdateSurveyStatusStmt                 *sql.Stmt
 	GetSurveyByShortNameStmt               *sql.Stmt
 	GetSurveyByReferenceStmt               *sql.Stmt
-	GetSurveyIDStmt                        *sql.Stmt
+	GetSurveyAsOfStmt                      *sql.Stmt
+	GetSurveyByReferenceAsOfStmt           *sql.Stmt
+	GetSurveyVersionStmt                   *sql.Stmt
+	LockSurveyVersionStmt                  *sql.Stmt
+	BumpSurveyVersionStmt                  *sql.Stmt
 	GetClassifierTypeSelectorStmt          *sql.Stmt
 	GetClassifierTypeSelectorByIDStmt      *sql.Stmt
+	GetClassifierTypeSelectorByIDAsOfStmt  *sql.Stmt
 	GetSurveyRefStmt                       *sql.Stmt
 	PutSurveyDetailsBySurveyRefStmt        *sql.Stmt
+	UpdateSurveyStmt                       *sql.Stmt
 	CreateSurveyStmt                       *sql.Stmt
 	CreateSurveyClassifierTypeSelectorStmt *sql.Stmt
 	CreateSurveyClassifierTypeStmt         *sql.Stmt
+	DeleteClassifierTypeSelectorsStmt      *sql.Stmt
+	GetSurveyClassifiersStmt               *sql.Stmt
+	CreateAuditStmt                        *sql.Stmt
+	GetSurveyHistoryStmt                   *sql.Stmt
+	CreateScheduledChangeStmt              *sql.Stmt
+	GetScheduledChangesStmt                *sql.Stmt
+	CancelScheduledChangeStmt              *sql.Stmt
+	NextDueScheduledChangeStmt             *sql.Stmt
+	CompleteScheduledChangeStmt            *sql.Stmt
+	ClaimIdempotencyKeyStmt                *sql.Stmt
+	GetIdempotencyKeyStmt                  *sql.Stmt
+	SaveIdempotentResponseStmt             *sql.Stmt
+	ReleaseIdempotencyKeyStmt              *sql.Stmt
+	DeleteExpiredIdempotencyKeysStmt       *sql.Stmt
 	GetLegalBasesStmt                      *sql.Stmt
 	GetLegalBasisFromLongNameStmt          *sql.Stmt
 	GetLegalBasisFromRefStmt               *sql.Stmt
 	GetSurveyByShortnameStmt               *sql.Stmt
 	GetSurveyPKByID                        *sql.Stmt
+	SurveyIDExistsStmt                     *sql.Stmt
+	GetExistingClassifierTypeSelectorIDs   *sql.Stmt
 	CountMatchingClassifierTypeSelectors   *sql.Stmt
+	RenameSurveyStmt                       *sql.Stmt
+	GetSurveyAliasStmt                     *sql.Stmt
+	GetSurveyAliasesStmt                   *sql.Stmt
+	CreateSurveyAliasStmt                  *sql.Stmt
+	DeleteSurveyAliasStmt                  *sql.Stmt
+	CountSurveyDependentsStmt              *sql.Stmt
+	CreateDeleteConfirmationStmt           *sql.Stmt
+	UseDeleteConfirmationStmt              *sql.Stmt
+	DeleteExpiredDeleteConfirmationsStmt   *sql.Stmt
+	MoveClassifierTypeSelectorStmt         *sql.Stmt
+	DeleteClassifierTypeSelectorStmt       *sql.Stmt
+	AddClassifierTypeStmt                  *sql.Stmt
+	MoveSurveyAliasesStmt                  *sql.Stmt
+	CreateSurveyTagStmt                    *sql.Stmt
+	DeleteSurveyTagStmt                    *sql.Stmt
+	GetTagUsageStmt                        *sql.Stmt
+	GetAttributeDefinitionsStmt            *sql.Stmt
+	PutAttributeDefinitionStmt             *sql.Stmt
+	DeleteAttributeDefinitionStmt          *sql.Stmt
+	CountSurveysWithAttributeStmt          *sql.Stmt
+	CountSurveysWithoutAttributeStmt       *sql.Stmt
+	GetSurveyOwnerStmt                     *sql.Stmt
+	PutSurveyOwnerStmt                     *sql.Stmt
+	DeleteSurveyOwnerStmt                  *sql.Stmt
+	GetSurveysByOwnerStmt                  *sql.Stmt
+	GetSurveyTranslationsStmt              *sql.Stmt
+	CreateSurveyTranslationStmt            *sql.Stmt
+	DeleteSurveyTranslationsStmt           *sql.Stmt
+	GetSurveyExternalIDsStmt               *sql.Stmt
+	PutSurveyExternalIDStmt                *sql.Stmt
+	DeleteSurveyExternalIDStmt             *sql.Stmt
+	GetSurveyIDByExternalIDStmt            *sql.Stmt
 	Validator                              *validator2.Validate
 	DB                                     *sql.DB
+	IdempotencyKeyTTL                      time.Duration
 }
 
 func init() {
@@ -131,45 +210,99 @@ func SetUpRoutes(r *mux.Router, api *API) {
 	r.HandleFunc("/surveys", use(api.AllSurveys, basicAuth)).Methods("GET")
 	r.HandleFunc("/surveys/surveytype/{surveyType}", use(api.SurveysByType, basicAuth)).Methods("GET")
 	r.HandleFunc("/legal-bases", use(api.AllLegalBases, basicAuth)).Methods("GET")
+	r.HandleFunc("/tags", use(api.AllTags, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveytypes/{surveyType}/attributes", use(api.AllAttributeDefinitions, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveytypes/{surveyType}/attributes/{name}", use(api.PutAttributeDefinition, basicAuth)).Methods("PUT")
+	r.HandleFunc("/surveytypes/{surveyType}/attributes/{name}", use(api.DeleteAttributeDefinition, basicAuth)).Methods("DELETE")
+	r.HandleFunc("/owners/{owner}/surveys", use(api.SurveysByOwner, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveys/export", use(api.ExportSurveys, basicAuth)).Methods("GET")
 	r.HandleFunc("/surveys/{surveyId}", use(api.GetSurvey, basicAuth)).Methods("GET")
 	r.HandleFunc("/surveys/{surveyId}", use(api.DeleteSurvey, basicAuth)).Methods("DELETE")
+	r.HandleFunc("/surveys/{surveyId}", use(api.PatchSurvey, basicAuth)).Methods("PATCH")
+	r.HandleFunc("/surveys/{surveyId}", use(api.PutSurvey, basicAuth)).Methods("PUT")
 	r.HandleFunc("/surveys/shortname/{shortName}", use(api.GetSurveyByShortName, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveys/external/{system}/{identifier}", use(api.GetSurveyByExternalID, basicAuth)).Methods("GET")
 	r.HandleFunc("/surveys/ref/{ref}", use(api.PutSurveyDetails, basicAuth)).Methods("PUT")
-	r.HandleFunc("/surveys", use(api.PostSurveyDetails, basicAuth)).Methods("POST")
+	r.HandleFunc("/surveys", use(api.PostSurveyDetails, api.idempotent, basicAuth)).Methods("POST")
+	r.HandleFunc("/surveys:validate", use(api.ValidateSurvey, basicAuth)).Methods("POST")
+	r.HandleFunc("/surveys/import", use(api.ImportSurveys, api.idempotent, basicAuth)).Methods("POST")
 	r.HandleFunc("/surveys/ref/{ref}", use(api.GetSurveyByReference, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveys/{surveyId}/delete-preview", use(api.GetDeletePreview, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveys/{surveyId}/restore", use(api.RestoreSurvey, basicAuth)).Methods("POST")
+	r.HandleFunc("/surveys/{surveyId}/clone", use(api.CloneSurvey, api.idempotent, basicAuth)).Methods("POST")
+	r.HandleFunc("/surveys/{surveyId}/merge", use(api.MergeSurvey, basicAuth)).Methods("POST")
+	r.HandleFunc("/surveys/{surveyId}/rename", use(api.RenameSurvey, basicAuth)).Methods("POST")
+	r.HandleFunc("/surveys/{surveyId}/aliases", use(api.GetSurveyAliases, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveys/{surveyId}/status", use(api.ChangeSurveyStatus, basicAuth)).Methods("POST")
+	r.HandleFunc("/surveys/{surveyId}/tags/{tag}", use(api.AddSurveyTag, basicAuth)).Methods("PUT")
+	r.HandleFunc("/surveys/{surveyId}/tags/{tag}", use(api.RemoveSurveyTag, basicAuth)).Methods("DELETE")
+	r.HandleFunc("/surveys/{surveyId}/owner", use(api.GetSurveyOwner, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveys/{surveyId}/owner", use(api.PutSurveyOwner, basicAuth)).Methods("PUT")
+	r.HandleFunc("/surveys/{surveyId}/owner", use(api.DeleteSurveyOwner, basicAuth)).Methods("DELETE")
+	r.HandleFunc("/surveys/{surveyId}/translations", use(api.AllSurveyTranslations, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveys/{surveyId}/translations/{locale}", use(api.PutSurveyTranslation, basicAuth)).Methods("PUT")
+	r.HandleFunc("/surveys/{surveyId}/translations/{locale}", use(api.DeleteSurveyTranslation, basicAuth)).Methods("DELETE")
+	r.HandleFunc("/surveys/{surveyId}/externalids", use(api.AllSurveyExternalIDs, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveys/{surveyId}/externalids/{system}", use(api.PutSurveyExternalID, basicAuth)).Methods("PUT")
+	r.HandleFunc("/surveys/{surveyId}/externalids/{system}", use(api.DeleteSurveyExternalID, basicAuth)).Methods("DELETE")
+	r.HandleFunc("/surveys/{surveyId}/periods/validate", use(api.ValidatePeriod, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveys/{surveyId}/history", use(api.GetSurveyHistory, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveys/{surveyId}/scheduledchanges", use(api.AllScheduledChanges, basicAuth)).Methods("GET")
+	r.HandleFunc("/surveys/{surveyId}/scheduledchanges", use(api.PostScheduledChange, basicAuth)).Methods("POST")
+	r.HandleFunc("/surveys/{surveyId}/scheduledchanges/{scheduledChangeId}", use(api.CancelScheduledChange, basicAuth)).Methods("DELETE")
 	r.HandleFunc("/surveys/{surveyId}/classifiertypeselectors", use(api.AllClassifierTypeSelectors, basicAuth)).Methods("GET")
 	r.HandleFunc("/surveys/{surveyId}/classifiertypeselectors/{classifierTypeSelectorId}", use(api.GetClassifierTypeSelectorByID, basicAuth)).Methods("GET")
-	r.HandleFunc("/surveys/{surveyId}/classifiers", use(api.PostSurveyClassifiers, basicAuth)).Methods("POST")
+	r.HandleFunc("/surveys/{surveyId}/classifiers", use(api.PostSurveyClassifiers, api.idempotent, basicAuth)).Methods("POST")
 }
 
 // NewAPI returns an API struct populated with all the created SQL statements
 func NewAPI(db *sql.DB) (*API, error) {
-	allSurveyStmt, err := createStmt("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref ORDER BY short_name ASC", db)
+	getSurveysBySurveyTypeStmt, err := createStmt("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.status, s.periodicity, s.period_format, s.attributes, ARRAY(SELECT t.tag FROM survey.survey_tag t WHERE t.survey_id = s.id ORDER BY t.tag), (SELECT json_build_object('division', o.division, 'teamMailbox', o.team_mailbox, 'helpline', o.helpline, 'escalationContacts', o.escalation_contacts) FROM survey.survey_owner o WHERE o.survey_id = s.id) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.survey_type = $1 AND s.archived_at IS NULL AND (cardinality($2::text[]) = 0 OR s.status::text = ANY($2)) ORDER BY short_name ASC", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyStmt, err := createStmt("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY(SELECT t.tag FROM survey.survey_tag t WHERE t.survey_id = s.id ORDER BY t.tag), (SELECT json_build_object('division', o.division, 'teamMailbox', o.team_mailbox, 'helpline', o.helpline, 'escalationContacts', o.escalation_contacts) FROM survey.survey_owner o WHERE o.survey_id = s.id) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = $1 AND s.archived_at IS NULL", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyIncludingArchivedStmt, err := createStmt("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyByShortNameStmt, err := createStmt("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY(SELECT t.tag FROM survey.survey_tag t WHERE t.survey_id = s.id ORDER BY t.tag), (SELECT json_build_object('division', o.division, 'teamMailbox', o.team_mailbox, 'helpline', o.helpline, 'escalationContacts', o.escalation_contacts) FROM survey.survey_owner o WHERE o.survey_id = s.id) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref  WHERE LOWER(short_name) = LOWER($1) AND s.archived_at IS NULL", db)
 	if err != nil {
 		return nil, err
 	}
 
-	getSurveysBySurveyTypeStmt, err := createStmt("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.survey_type = $1 ORDER BY short_name ASC", db)
+	getSurveyByReferenceStmt, err := createStmt("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY(SELECT t.tag FROM survey.survey_tag t WHERE t.survey_id = s.id ORDER BY t.tag), (SELECT json_build_object('division', o.division, 'teamMailbox', o.team_mailbox, 'helpline', o.helpline, 'escalationContacts', o.escalation_contacts) FROM survey.survey_owner o WHERE o.survey_id = s.id) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref  WHERE LOWER(survey_ref) = LOWER($1) AND s.archived_at IS NULL", db)
 	if err != nil {
 		return nil, err
 	}
 
-	getSurveyStmt, err := createStmt("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = $1", db)
+	getSurveyAsOfStmt, err := createStmt("SELECT h.id, h.short_name, h.long_name, h.survey_ref, h.legal_basis, h.survey_type, h.survey_mode, lb.long_name, h.version, h.status, h.periodicity, h.period_format, h.attributes FROM survey.survey_history h INNER JOIN survey.legalbasis lb on h.legal_basis = lb.ref WHERE h.id = $1 AND h.archived_at IS NULL AND h.valid_from <= $2 AND (h.valid_to IS NULL OR h.valid_to > $2)", db)
 	if err != nil {
 		return nil, err
 	}
 
-	getSurveyByShortNameStmt, err := createStmt("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref  WHERE LOWER(short_name) = LOWER($1)", db)
+	getSurveyByReferenceAsOfStmt, err := createStmt("SELECT h.id, h.short_name, h.long_name, h.survey_ref, h.legal_basis, h.survey_type, h.survey_mode, lb.long_name, h.version, h.status, h.periodicity, h.period_format, h.attributes FROM survey.survey_history h INNER JOIN survey.legalbasis lb on h.legal_basis = lb.ref WHERE LOWER(h.survey_ref) = LOWER($1) AND h.archived_at IS NULL AND h.valid_from <= $2 AND (h.valid_to IS NULL OR h.valid_to > $2)", db)
 	if err != nil {
 		return nil, err
 	}
 
-	getSurveyByReferenceStmt, err := createStmt("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref  WHERE LOWER(survey_ref) = LOWER($1)", db)
+	getSurveyVersionStmt, err := createStmt("SELECT version FROM survey.survey WHERE id = $1 AND archived_at IS NULL", db)
 	if err != nil {
 		return nil, err
 	}
 
-	getSurveyIDStmt, err := createStmt("SELECT id FROM survey.survey WHERE id = $1", db)
+	lockSurveyVersionStmt, err := createStmt("SELECT version FROM survey.survey WHERE id = $1 FOR UPDATE", db)
+	if err != nil {
+		return nil, err
+	}
+
+	bumpSurveyVersionStmt, err := createStmt("UPDATE survey.survey SET version = version + 1 WHERE id = $1 RETURNING version", db)
 	if err != nil {
 		return nil, err
 	}
@@ -179,6 +312,21 @@ func NewAPI(db *sql.DB) (*API, error) {
 		return nil, err
 	}
 
+	archiveSurveyStmt, err := createStmt("UPDATE survey.survey SET archived_at = now() WHERE id = $1 AND archived_at IS NULL RETURNING archived_at", db)
+	if err != nil {
+		return nil, err
+	}
+
+	restoreSurveyStmt, err := createStmt("UPDATE survey.survey SET archived_at = NULL WHERE id = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
+	updateSurveyStatusStmt, err := createStmt("UPDATE survey.survey SET status = $2 WHERE id = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
 	getClassifierTypeSelectorStmt, err := createStmt("SELECT classifiertypeselector.id, classifier_type_selector FROM survey.classifiertypeselector INNER JOIN survey.survey ON classifiertypeselector.survey_fk = survey.survey_pk WHERE survey.id = $1 ORDER BY classifier_type_selector ASC", db)
 	if err != nil {
 		return nil, err
@@ -189,17 +337,27 @@ func NewAPI(db *sql.DB) (*API, error) {
 		return nil, err
 	}
 
+	getClassifierTypeSelectorByIDAsOfStmt, err := createStmt("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type FROM survey.classifiertype_history ct INNER JOIN survey.classifiertypeselector_history cts ON ct.classifier_type_selector_fk = cts.classifier_type_selector_pk WHERE cts.id = $1 AND cts.valid_from <= $2 AND (cts.valid_to IS NULL OR cts.valid_to > $2) AND ct.valid_from <= $2 AND (ct.valid_to IS NULL OR ct.valid_to > $2) ORDER BY ct.classifier_type ASC", db)
+	if err != nil {
+		return nil, err
+	}
+
 	getSurveyRefStmt, err := createStmt("SELECT survey_ref FROM survey.survey WHERE LOWER(survey_ref) = LOWER($1)", db)
 	if err != nil {
 		return nil, err
 	}
 
-	putSurveyDetailsBySurveyRefStmt, err := createStmt("UPDATE survey.survey SET short_name = $2, long_name = $3, survey_mode = $4 WHERE LOWER(survey_ref) = LOWER($1)", db)
+	updateSurveyStmt, err := createStmt("UPDATE survey.survey SET survey_ref = $2, short_name = $3, long_name = $4, legal_basis = $5, survey_type = $6, survey_mode = $7, periodicity = $8, period_format = $9, attributes = $10 WHERE id = $1", db)
 	if err != nil {
 		return nil, err
 	}
 
-	createSurvey, err := createStmt("INSERT INTO survey.survey ( survey_pk, id, survey_ref, short_name, long_name, legal_basis, survey_type, survey_mode ) VALUES ( nextval('survey.survey_surveypk_seq'), $1, $2, $3, $4, $5, $6, $7) RETURNING survey_pk", db)
+	putSurveyDetailsBySurveyRefStmt, err := createStmt("UPDATE survey.survey SET short_name = $2, long_name = $3, survey_mode = $4 WHERE LOWER(survey_ref) = LOWER($1) AND archived_at IS NULL", db)
+	if err != nil {
+		return nil, err
+	}
+
+	createSurvey, err := createStmt("INSERT INTO survey.survey ( survey_pk, id, survey_ref, short_name, long_name, legal_basis, survey_type, survey_mode, periodicity, period_format, attributes ) VALUES ( nextval('survey.survey_surveypk_seq'), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING survey_pk, version, status", db)
 	if err != nil {
 		return nil, err
 	}
@@ -234,7 +392,88 @@ func NewAPI(db *sql.DB) (*API, error) {
 		return nil, err
 	}
 
-	getSurveyPKByID, err := createStmt("SELECT survey_pk FROM survey.survey WHERE id = $1", db)
+	deleteClassifierTypeSelectorsBySurveyStmt, err := createStmt("DELETE FROM survey.classifiertypeselector WHERE survey_fk = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyClassifiersStmt, err := createStmt("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type FROM survey.classifiertypeselector cts INNER JOIN survey.survey s ON cts.survey_fk = s.survey_pk LEFT JOIN survey.classifiertype ct ON ct.classifier_type_selector_fk = cts.classifier_type_selector_pk WHERE s.id = $1 ORDER BY cts.classifier_type_selector, cts.id, ct.classifier_type", db)
+	if err != nil {
+		return nil, err
+	}
+
+	createAuditStmt, err := createStmt("INSERT INTO survey.audit ( survey_id, actor, operation, before_state, after_state ) VALUES ( $1, $2, $3, $4, $5 )", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyHistoryStmt, err := createStmt("SELECT actor, occurred_at, operation, before_state, after_state FROM survey.audit WHERE survey_id = $1 ORDER BY audit_pk ASC", db)
+	if err != nil {
+		return nil, err
+	}
+
+	createScheduledChangeStmt, err := createStmt("INSERT INTO survey.scheduled_change ( id, survey_id, changes, effective_from, created_by ) VALUES ( $1, $2, $3, $4, $5 ) RETURNING state, created_at", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getScheduledChangesStmt, err := createStmt("SELECT id, survey_id, changes, effective_from, state, created_by, created_at, processed_at, COALESCE(failure_reason, '') FROM survey.scheduled_change WHERE survey_id = $1 AND (state = 'PENDING' OR $2) ORDER BY effective_from ASC, scheduled_change_pk ASC", db)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelScheduledChangeStmt, err := createStmt("UPDATE survey.scheduled_change SET state = 'CANCELLED', processed_at = now() WHERE id = $1 AND survey_id = $2 AND state = 'PENDING'", db)
+	if err != nil {
+		return nil, err
+	}
+
+	nextDueScheduledChangeStmt, err := createStmt("SELECT id, survey_id, changes, created_by FROM survey.scheduled_change WHERE state = 'PENDING' AND effective_from <= now() ORDER BY effective_from ASC, scheduled_change_pk ASC LIMIT 1 FOR UPDATE SKIP LOCKED", db)
+	if err != nil {
+		return nil, err
+	}
+
+	completeScheduledChangeStmt, err := createStmt("UPDATE survey.scheduled_change SET state = $2, processed_at = now(), failure_reason = NULLIF($3, '') WHERE id = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
+	// A key can be claimed again once it has expired, or if the request that claimed it never finished
+	claimIdempotencyKeyStmt, err := createStmt("INSERT INTO survey.idempotency_key ( actor, idempotency_key, request_hash, expires_at ) VALUES ( $1, $2, $3, now() + $4 * interval '1 second' ) ON CONFLICT ( actor, idempotency_key ) DO UPDATE SET request_hash = EXCLUDED.request_hash, status_code = NULL, response_headers = NULL, response_body = NULL, created_at = now(), expires_at = EXCLUDED.expires_at WHERE survey.idempotency_key.expires_at < now() OR (survey.idempotency_key.status_code IS NULL AND survey.idempotency_key.created_at < now() - interval '1 minute')", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getIdempotencyKeyStmt, err := createStmt("SELECT request_hash, status_code, response_headers, response_body FROM survey.idempotency_key WHERE actor = $1 AND idempotency_key = $2", db)
+	if err != nil {
+		return nil, err
+	}
+
+	saveIdempotentResponseStmt, err := createStmt("UPDATE survey.idempotency_key SET status_code = $3, response_headers = $4, response_body = $5 WHERE actor = $1 AND idempotency_key = $2", db)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseIdempotencyKeyStmt, err := createStmt("DELETE FROM survey.idempotency_key WHERE actor = $1 AND idempotency_key = $2", db)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteExpiredIdempotencyKeysStmt, err := createStmt("DELETE FROM survey.idempotency_key WHERE expires_at < now()", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyPKByID, err := createStmt("SELECT survey_pk FROM survey.survey WHERE id = $1 AND archived_at IS NULL", db)
+	if err != nil {
+		return nil, err
+	}
+
+	surveyIDExistsStmt, err := createStmt("SELECT EXISTS (SELECT 1 FROM survey.survey WHERE id = $1)", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getExistingClassifierTypeSelectorIDs, err := createStmt("SELECT id FROM survey.classifiertypeselector WHERE id = ANY($1::uuid[])", db)
 	if err != nil {
 		return nil, err
 	}
@@ -244,31 +483,251 @@ func NewAPI(db *sql.DB) (*API, error) {
 		return nil, err
 	}
 
+	renameSurveyStmt, err := createStmt("UPDATE survey.survey SET short_name = $2, survey_ref = $3 WHERE id = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyAliasStmt, err := createStmt("SELECT survey_id FROM survey.survey_alias WHERE kind = $1 AND LOWER(alias) = LOWER($2)", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyAliasesStmt, err := createStmt("SELECT kind, alias, created_by, created_at FROM survey.survey_alias WHERE survey_id = $1 ORDER BY created_at, survey_alias_pk", db)
+	if err != nil {
+		return nil, err
+	}
+
+	createSurveyAliasStmt, err := createStmt("INSERT INTO survey.survey_alias (survey_id, kind, alias, created_by) VALUES ($1, $2, $3, $4)", db)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteSurveyAliasStmt, err := createStmt("DELETE FROM survey.survey_alias WHERE survey_id = $1 AND kind = $2 AND LOWER(alias) = LOWER($3)", db)
+	if err != nil {
+		return nil, err
+	}
+
+	countSurveyDependentsStmt, err := createStmt("SELECT (SELECT COUNT(*) FROM survey.scheduled_change WHERE survey_id = $1), (SELECT COUNT(*) FROM survey.survey_alias WHERE survey_id = $1), "+
+		"(SELECT COUNT(*) FROM survey.survey_tag WHERE survey_id = $1), (SELECT COUNT(*) FROM survey.survey_owner WHERE survey_id = $1), "+
+		"(SELECT COUNT(*) FROM survey.survey_translation WHERE survey_id = $1), (SELECT COUNT(*) FROM survey.survey_external_id WHERE survey_id = $1)", db)
+	if err != nil {
+		return nil, err
+	}
+
+	createDeleteConfirmationStmt, err := createStmt("INSERT INTO survey.delete_confirmation (token, survey_id, version, created_by, expires_at) VALUES ($1, $2, $3, $4, $5)", db)
+	if err != nil {
+		return nil, err
+	}
+
+	useDeleteConfirmationStmt, err := createStmt("DELETE FROM survey.delete_confirmation WHERE token = $1 AND survey_id = $2 AND expires_at > now() RETURNING version", db)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteExpiredDeleteConfirmationsStmt, err := createStmt("DELETE FROM survey.delete_confirmation WHERE expires_at < now()", db)
+	if err != nil {
+		return nil, err
+	}
+
+	moveClassifierTypeSelectorStmt, err := createStmt("UPDATE survey.classifiertypeselector SET survey_fk = $2 WHERE id = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteClassifierTypeSelectorStmt, err := createStmt("DELETE FROM survey.classifiertypeselector WHERE id = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
+	addClassifierTypeStmt, err := createStmt("INSERT INTO survey.classifiertype (classifier_type_selector_fk, classifier_type) SELECT classifier_type_selector_pk, $2 FROM survey.classifiertypeselector WHERE id = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
+	moveSurveyAliasesStmt, err := createStmt("UPDATE survey.survey_alias SET survey_id = $2 WHERE survey_id = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
+	createSurveyTagStmt, err := createStmt("INSERT INTO survey.survey_tag (survey_id, tag, created_by) VALUES ($1, $2, $3)", db)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteSurveyTagStmt, err := createStmt("DELETE FROM survey.survey_tag WHERE survey_id = $1 AND tag = $2", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getTagUsageStmt, err := createStmt("SELECT t.tag, COUNT(*) FROM survey.survey_tag t INNER JOIN survey.survey s ON s.id = t.survey_id WHERE s.archived_at IS NULL GROUP BY t.tag ORDER BY t.tag", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getAttributeDefinitionsStmt, err := createStmt("SELECT survey_type, name, json_type, required, allowed_values FROM survey.attribute_definition WHERE survey_type = $1 ORDER BY name", db)
+	if err != nil {
+		return nil, err
+	}
+
+	putAttributeDefinitionStmt, err := createStmt("INSERT INTO survey.attribute_definition (survey_type, name, json_type, required, allowed_values, created_by) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (survey_type, name) DO UPDATE SET json_type = EXCLUDED.json_type, required = EXCLUDED.required, allowed_values = EXCLUDED.allowed_values", db)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteAttributeDefinitionStmt, err := createStmt("DELETE FROM survey.attribute_definition WHERE survey_type = $1 AND name = $2", db)
+	if err != nil {
+		return nil, err
+	}
+
+	countSurveysWithAttributeStmt, err := createStmt("SELECT COUNT(*) FROM survey.survey WHERE survey_type = $1 AND attributes ? $2", db)
+	if err != nil {
+		return nil, err
+	}
+
+	countSurveysWithoutAttributeStmt, err := createStmt("SELECT COUNT(*) FROM survey.survey WHERE survey_type = $1 AND NOT attributes ? $2", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyOwnerStmt, err := createStmt("SELECT division, team_mailbox, helpline, escalation_contacts FROM survey.survey_owner WHERE survey_id = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
+	putSurveyOwnerStmt, err := createStmt("INSERT INTO survey.survey_owner (survey_id, division, team_mailbox, helpline, escalation_contacts, updated_by) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (survey_id) DO UPDATE SET division = EXCLUDED.division, team_mailbox = EXCLUDED.team_mailbox, helpline = EXCLUDED.helpline, escalation_contacts = EXCLUDED.escalation_contacts, updated_by = EXCLUDED.updated_by, updated_at = now()", db)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteSurveyOwnerStmt, err := createStmt("DELETE FROM survey.survey_owner WHERE survey_id = $1", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveysByOwnerStmt, err := createStmt(surveyListSelect+" WHERE EXISTS (SELECT 1 FROM survey.survey_owner o WHERE o.survey_id = s.id AND (LOWER(o.division) = LOWER($1) OR LOWER(o.team_mailbox) = LOWER($1))) AND s.archived_at IS NULL ORDER BY s.short_name ASC", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyTranslationsStmt, err := createStmt("SELECT survey_id, locale, field, value FROM survey.survey_translation WHERE survey_id = ANY($1::uuid[]) ORDER BY survey_id, locale, field", db)
+	if err != nil {
+		return nil, err
+	}
+
+	createSurveyTranslationStmt, err := createStmt("INSERT INTO survey.survey_translation (survey_id, locale, field, value, updated_by) VALUES ($1, $2, $3, $4, $5)", db)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteSurveyTranslationsStmt, err := createStmt("DELETE FROM survey.survey_translation WHERE survey_id = $1 AND locale = $2", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyExternalIDsStmt, err := createStmt("SELECT system, identifier FROM survey.survey_external_id WHERE survey_id = $1 ORDER BY system", db)
+	if err != nil {
+		return nil, err
+	}
+
+	putSurveyExternalIDStmt, err := createStmt("INSERT INTO survey.survey_external_id (survey_id, system, identifier, updated_by) VALUES ($1, $2, $3, $4) ON CONFLICT (survey_id, system) DO UPDATE SET identifier = EXCLUDED.identifier, updated_by = EXCLUDED.updated_by, updated_at = now()", db)
+	if err != nil {
+		return nil, err
+	}
+
+	deleteSurveyExternalIDStmt, err := createStmt("DELETE FROM survey.survey_external_id WHERE survey_id = $1 AND system = $2", db)
+	if err != nil {
+		return nil, err
+	}
+
+	getSurveyIDByExternalIDStmt, err := createStmt("SELECT survey_id FROM survey.survey_external_id WHERE system = $1 AND identifier = $2", db)
+	if err != nil {
+		return nil, err
+	}
+
 	validator := createValidator()
 
 	return &API{
-			AllSurveysStmt:                         allSurveyStmt,
 			GetSurveysBySurveyTypeStmt:             getSurveysBySurveyTypeStmt,
 			GetSurveyStmt:                          getSurveyStmt,
+			GetSurveyIncludingArchivedStmt:         getSurveyIncludingArchivedStmt,
 			GetSurveyByShortNameStmt:               getSurveyByShortNameStmt,
 			GetSurveyByReferenceStmt:               getSurveyByReferenceStmt,
-			GetSurveyIDStmt:                        getSurveyIDStmt,
+			GetSurveyAsOfStmt:                      getSurveyAsOfStmt,
+			GetSurveyByReferenceAsOfStmt:           getSurveyByReferenceAsOfStmt,
+			GetSurveyVersionStmt:                   getSurveyVersionStmt,
+			LockSurveyVersionStmt:                  lockSurveyVersionStmt,
+			BumpSurveyVersionStmt:                  bumpSurveyVersionStmt,
 			DeleteSurveyByIDStmt:                   deleteSurveyByIDStmt,
+			ArchiveSurveyStmt:                      archiveSurveyStmt,
+			RestoreSurveyStmt:                      restoreSurveyStmt,
+			UpdateSurveyStatusStmt:                 updateSurveyStatusStmt,
 			GetClassifierTypeSelectorStmt:          getClassifierTypeSelectorStmt,
 			GetClassifierTypeSelectorByIDStmt:      getClassifierTypeSelectorByIDStmt,
+			GetClassifierTypeSelectorByIDAsOfStmt:  getClassifierTypeSelectorByIDAsOfStmt,
 			GetSurveyRefStmt:                       getSurveyRefStmt,
 			PutSurveyDetailsBySurveyRefStmt:        putSurveyDetailsBySurveyRefStmt,
+			UpdateSurveyStmt:                       updateSurveyStmt,
 			CreateSurveyStmt:                       createSurvey,
 			CreateSurveyClassifierTypeSelectorStmt: createSurveyClassifierTypeSelectorStmt,
 			CreateSurveyClassifierTypeStmt:         createSurveyClassifierTypeStmt,
+			DeleteClassifierTypeSelectorsStmt:      deleteClassifierTypeSelectorsBySurveyStmt,
+			GetSurveyClassifiersStmt:               getSurveyClassifiersStmt,
+			CreateAuditStmt:                        createAuditStmt,
+			GetSurveyHistoryStmt:                   getSurveyHistoryStmt,
+			CreateScheduledChangeStmt:              createScheduledChangeStmt,
+			GetScheduledChangesStmt:                getScheduledChangesStmt,
+			CancelScheduledChangeStmt:              cancelScheduledChangeStmt,
+			NextDueScheduledChangeStmt:             nextDueScheduledChangeStmt,
+			CompleteScheduledChangeStmt:            completeScheduledChangeStmt,
+			ClaimIdempotencyKeyStmt:                claimIdempotencyKeyStmt,
+			GetIdempotencyKeyStmt:                  getIdempotencyKeyStmt,
+			SaveIdempotentResponseStmt:             saveIdempotentResponseStmt,
+			ReleaseIdempotencyKeyStmt:              releaseIdempotencyKeyStmt,
+			DeleteExpiredIdempotencyKeysStmt:       deleteExpiredIdempotencyKeysStmt,
 			GetLegalBasesStmt:                      getLegalBases,
 			GetLegalBasisFromLongNameStmt:          getLegalBasisFromLongName,
 			GetLegalBasisFromRefStmt:               getLegalBasisFromRef,
 			GetSurveyByShortnameStmt:               getSurveyByShortname,
 			GetSurveyPKByID:                        getSurveyPKByID,
+			SurveyIDExistsStmt:                     surveyIDExistsStmt,
+			GetExistingClassifierTypeSelectorIDs:   getExistingClassifierTypeSelectorIDs,
 			CountMatchingClassifierTypeSelectors:   countMatchingClassifierTypeSelectorStmt,
+			RenameSurveyStmt:                       renameSurveyStmt,
+			GetSurveyAliasStmt:                     getSurveyAliasStmt,
+			GetSurveyAliasesStmt:                   getSurveyAliasesStmt,
+			CreateSurveyAliasStmt:                  createSurveyAliasStmt,
+			DeleteSurveyAliasStmt:                  deleteSurveyAliasStmt,
+			CountSurveyDependentsStmt:              countSurveyDependentsStmt,
+			CreateDeleteConfirmationStmt:           createDeleteConfirmationStmt,
+			UseDeleteConfirmationStmt:              useDeleteConfirmationStmt,
+			DeleteExpiredDeleteConfirmationsStmt:   deleteExpiredDeleteConfirmationsStmt,
+			MoveClassifierTypeSelectorStmt:         moveClassifierTypeSelectorStmt,
+			DeleteClassifierTypeSelectorStmt:       deleteClassifierTypeSelectorStmt,
+			AddClassifierTypeStmt:                  addClassifierTypeStmt,
+			MoveSurveyAliasesStmt:                  moveSurveyAliasesStmt,
+			CreateSurveyTagStmt:                    createSurveyTagStmt,
+			DeleteSurveyTagStmt:                    deleteSurveyTagStmt,
+			GetTagUsageStmt:                        getTagUsageStmt,
+			GetAttributeDefinitionsStmt:            getAttributeDefinitionsStmt,
+			PutAttributeDefinitionStmt:             putAttributeDefinitionStmt,
+			DeleteAttributeDefinitionStmt:          deleteAttributeDefinitionStmt,
+			CountSurveysWithAttributeStmt:          countSurveysWithAttributeStmt,
+			CountSurveysWithoutAttributeStmt:       countSurveysWithoutAttributeStmt,
+			GetSurveyOwnerStmt:                     getSurveyOwnerStmt,
+			PutSurveyOwnerStmt:                     putSurveyOwnerStmt,
+			DeleteSurveyOwnerStmt:                  deleteSurveyOwnerStmt,
+			GetSurveysByOwnerStmt:                  getSurveysByOwnerStmt,
+			GetSurveyTranslationsStmt:              getSurveyTranslationsStmt,
+			CreateSurveyTranslationStmt:            createSurveyTranslationStmt,
+			DeleteSurveyTranslationsStmt:           deleteSurveyTranslationsStmt,
+			GetSurveyExternalIDsStmt:               getSurveyExternalIDsStmt,
+			PutSurveyExternalIDStmt:                putSurveyExternalIDStmt,
+			DeleteSurveyExternalIDStmt:             deleteSurveyExternalIDStmt,
+			GetSurveyIDByExternalIDStmt:            getSurveyIDByExternalIDStmt,
 			Validator:                              validator,
-			DB:                                     db},
+			DB:                                     db,
+			IdempotencyKeyTTL:                      defaultIdempotencyKeyTTL},
 		nil
 }
 
@@ -297,10 +756,25 @@ func createValidator() *validator2.Validate {
 	validator := validator2.New()
 
 	validator.RegisterValidation("no-spaces", validateNoSpaces)
+	validator.RegisterValidation("phone", validatePhone)
 
 	return validator
 }
 
+// requestError is an error which should be reported to the caller with the given HTTP status code
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func newRequestError(status int, format string, a ...interface{}) *requestError {
+	return &requestError{status: status, message: fmt.Sprintf(format, a...)}
+}
+
 // PostSurveyDetails endpoint handler - creates a new survey based on JSON in request
 func (api *API) PostSurveyDetails(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
@@ -312,141 +786,104 @@ func (api *API) PostSurveyDetails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var legalBasis LegalBasis
-	var errorMessage string
-
-	if survey.LegalBasisRef != "" {
-		legalBasis, err = api.getLegalBasisFromRef(survey.LegalBasisRef)
-		errorMessage = fmt.Sprintf("Legal basis with reference %v does not exist", survey.LegalBasisRef)
-	} else if survey.LegalBasis != "" {
-		legalBasis, err = api.getLegalBasisFromLongName(survey.LegalBasis)
-		errorMessage = fmt.Sprintf("Legal basis %v does not exist", survey.LegalBasis)
-	} else {
-		http.Error(w, "No legal basis specified for survey", http.StatusBadRequest)
+	// Every classifier is checked before anything is written so a bad one doesn't leave a half built survey
+	legalBasis, problems, err := api.checkSurvey(&survey, "")
+	if err != nil {
+		logErrorAndRespond(w, "Error validating survey", http.StatusInternalServerError, err)
+		return
+	} else if len(problems) > 0 {
+		writeSurveyProblems(w, problems)
 		return
 	}
 
-	validSurveyTypes := map[string]bool{"Census": true, "Business": true, "Social": true}
-	if _, ok := validSurveyTypes[survey.SurveyType]; !ok {
-		http.Error(w, "Survey type must be one of [Census, Business, Social]", http.StatusBadRequest)
+	// A survey keeps the id it's given, so the same survey can have the same id in every environment
+	surveyID := uuid.FromStringOrNil(survey.ID)
+	if surveyID == uuid.Nil {
+		if surveyID, err = uuid.NewV4(); err != nil {
+			http.Error(w, fmt.Sprintf("Error generating random uuid"), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Update the data passed in with the generated values so we can return them
+	// to the caller
+	survey.ID = surveyID.String()
+	survey.ArchivedAt = nil
+	survey.LegalBasisRef = legalBasis.Reference
+	survey.LegalBasis = legalBasis.LongName
+	actor := requestActor(r)
+
+	// If the survey and its classifiers are valid then they are created together in one transaction, so a
+	// failure part way through leaves nothing behind
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
 		return
 	}
 
-	if err == sql.ErrNoRows {
-		http.Error(w, errorMessage, http.StatusBadRequest)
+	version, err := api.insertSurvey(tx, &survey, actor)
+	if isUniqueViolation(err) {
+		rollBack(tx)
+		http.Error(w, "A survey with the same id, short name or reference, or a classifier type selector with the same id, already exists", http.StatusConflict)
 		return
 	} else if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting legal basis - %v", err), http.StatusInternalServerError)
+		rollBack(tx)
+		logErrorAndRespond(w, "Create survey failed", http.StatusInternalServerError, err)
 		return
 	}
 
-	// Generate a UUID to uniquely identify the new survey
-	surveyID, err := uuid.NewV4()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error generating random uuid"), http.StatusInternalServerError)
-		return
-	}
-	// Check whether the survey shortname already exists in the database, returning
-	// an error if it does
-	_, err = api.getSurveyByShortname(survey.ShortName)
-	if (err != nil && err != sql.ErrNoRows) || err == nil {
-		http.Error(w, fmt.Sprintf("The survey with Abbreviation %v already exists", survey.ShortName), http.StatusConflict)
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
 		return
 	}
 
-	// If the reference is unique then we can go ahead and create the survey and
-	// it's classifiers
-	if err = api.getSurveyRef(survey.Reference); err == sql.ErrNoRows {
+	var js []byte
+	js, err = json.Marshal(&survey)
 
-		if err := api.Validator.Struct(survey); err != nil {
-			http.Error(w, fmt.Sprintf("Survey failed to validate - %v", err), http.StatusBadRequest)
-			return
-		}
-		surveyPK := 0
-		err := api.CreateSurveyStmt.QueryRow(
-			surveyID,
-			survey.Reference,
-			survey.ShortName,
-			survey.LongName,
-			legalBasis.Reference,
-			survey.SurveyType,
-			survey.SurveyMode,
-		).Scan(&surveyPK)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Create survey details failed - %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		// If the main survey record has been correctly created then, if a set of
-		// classifiers have been supplied, we want to create them.
-		if survey.Classifiers != nil {
-			for _, c := range survey.Classifiers {
-				_, err := api.createClassifiers(int(surveyPK), surveyID.String(), c.Name, c.ClassifierTypes)
-				if err != nil {
-					logErrorAndRespond(w, "Failed to insert classifier '"+c.Name+"'", http.StatusInternalServerError, err)
-					return
-				}
-			}
-		}
+	logger.Info("New survey created",
+		zap.String("service", serviceName),
+		zap.String("event", "created survey"),
+		zap.String("survey_id", survey.ID),
+		zap.String("survey_name", survey.LongName),
+		zap.String("survey_type", survey.SurveyType),
+		zap.String("survey_mode", survey.SurveyMode),
+		zap.String("created", time.Now().UTC().Format(timeFormat)))
 
-		// Update the data passed in with the generated values so we can return them
-		// to the caller
-		survey.ID = surveyID.String()
-		survey.LegalBasisRef = legalBasis.Reference
-		survey.LegalBasis = legalBasis.LongName
-
-		var js []byte
-		js, err = json.Marshal(&survey)
-
-		logger.Info("New survey created",
-			zap.String("service", serviceName),
-			zap.String("event", "created survey"),
-			zap.String("survey_id", survey.ID),
-			zap.String("survey_name", survey.LongName),
-			zap.String("survey_type", survey.SurveyType),
-			zap.String("survey_mode", survey.SurveyMode),
-			zap.String("created", time.Now().UTC().Format(timeFormat)))
-
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		w.WriteHeader(http.StatusCreated)
-		w.Write(js)
-	} else if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to validate survey ref - %v", err), http.StatusInternalServerError)
-		return
-	} else {
-		http.Error(w, fmt.Sprintf("Survey with reference %v already exists", survey.Reference), http.StatusConflict)
-		return
-	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", surveyETag(version))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(js)
 }
 
-// Insert a list of classifier types into the database given type selector primary key using transaction tx
+// Insert a list of classifier types into the database given type selector primary key using transaction tx. The
+// caller rolls the transaction back if an insert fails.
 func (api *API) insertClassifierTypes(classifierTypes []string, typeSelectorPK int, tx *sql.Tx) error {
 	txCreateSurveyClassifierTypeStmt := tx.Stmt(api.CreateSurveyClassifierTypeStmt)
 	for _, classifierType := range classifierTypes {
 		_, err := txCreateSurveyClassifierTypeStmt.Exec(typeSelectorPK, classifierType)
 		if err != nil {
-			rollBack(tx)
 			return err
 		}
 	}
 	return nil
 }
 
-// Insert a classifier type selector into the database given survey primary key using transaction tx, return the PK and UUID
-func (api *API) insertClassifierTypeSelector(name string, surveyPK int, tx *sql.Tx) (int, uuid.UUID, error) {
+// Insert a classifier type selector into the database given survey primary key using transaction tx, return the PK and UUID.
+// A new UUID is generated unless classifierTypeSelectorID is given.
+func (api *API) insertClassifierTypeSelector(name string, surveyPK int, classifierTypeSelectorID uuid.UUID, tx *sql.Tx) (int, uuid.UUID, error) {
 	txCreateSurveyClassifierTypeSelectorStmt := tx.Stmt(api.CreateSurveyClassifierTypeSelectorStmt)
 	var typeSelectorPK int
-	classifierTypeSelectorID, err := uuid.NewV4()
-	if err != nil {
-		tx.Rollback()
-		return typeSelectorPK, uuid.Nil, errors.New("Error generating random uuid")
+	var err error
+	if classifierTypeSelectorID == uuid.Nil {
+		classifierTypeSelectorID, err = uuid.NewV4()
+		if err != nil {
+			return typeSelectorPK, uuid.Nil, errors.New("Error generating random uuid")
+		}
 	}
 	err = txCreateSurveyClassifierTypeSelectorStmt.
 		QueryRow(classifierTypeSelectorID, surveyPK, name).
 		Scan(&typeSelectorPK)
-	if err != nil {
-		rollBack(tx)
-	}
 	return typeSelectorPK, classifierTypeSelectorID, err
 }
 
@@ -502,13 +939,28 @@ func (api *API) PostSurveyClassifiers(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
 		return
 	}
-	err = api.Validator.Struct(postData)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if rejections := api.checkClassifiers([]ClassifierTypeSelector{postData}); len(rejections) > 0 {
+		http.Error(w, "Invalid request body - "+rejections[0].Reason, http.StatusBadRequest)
+		return
+	}
+
+	// The classifier type selector keeps the id it's given, if any
+	if postData.ID != "" {
+		if rejections, err := api.checkClassifierIDsUnused([]ClassifierTypeSelector{postData}); err != nil {
+			logErrorAndRespond(w, "Error checking classifier type selector id", http.StatusInternalServerError, err)
+			return
+		} else if len(rejections) > 0 {
+			http.Error(w, rejections[0].Reason, http.StatusConflict)
+			return
+		}
+	}
+
+	classifierID, version, err := api.createClassifiers(surveyPK, surveyID, postData, requestActor(r), r.Header.Get("If-Match"))
+	if err == errPreconditionFailed {
+		writePreconditionError(w, err)
 		return
 	}
 
-	classifierID, err := api.createClassifiers(surveyPK, surveyID, postData.Name, postData.ClassifierTypes)
 	if err != nil {
 		logErrorAndRespond(w, "Failed to create classifiers", http.StatusInternalServerError, err)
 		return
@@ -519,49 +971,56 @@ func (api *API) PostSurveyClassifiers(w http.ResponseWriter, r *http.Request) {
 	createdClassifier.ID = classifierID
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("ETag", surveyETag(version))
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(createdClassifier); err != nil {
 		logError("Error encoding response to 'post survey classifiers'", err)
 	}
 }
 
-func (api *API) createClassifiers(surveyPK int, surveyID, name string, types []string) (string, error) {
+// createClassifiers creates a classifier type selector and its classifier types for a survey, returning the UUID of
+// the selector and the new version of the survey. ifMatch is checked against the survey's version if it's given.
+func (api *API) createClassifiers(surveyPK int, surveyID string, classifier ClassifierTypeSelector, actor, ifMatch string) (string, int, error) {
+	name := classifier.Name
 	logger.Info("Creating classifiers", zap.String("surveyID", surveyID))
 	// Check if classifier type selector already exists
 	classifierTypeSelectorAlreadyExists, err := api.classifierTypeSelectorExists(name, surveyID)
 	if err != nil {
-		return "", errors.Wrap(err, "Error counting existing classifier type selectors")
+		return "", 0, errors.Wrap(err, "Error counting existing classifier type selectors")
 	}
 	if classifierTypeSelectorAlreadyExists {
-		return "", errors.New(fmt.Sprintf("Type selector with name '%s' already exists for this survey with ID '%s'", name, surveyID))
+		return "", 0, errors.New(fmt.Sprintf("Type selector with name '%s' already exists for this survey with ID '%s'", name, surveyID))
 	}
 
 	// Start database transaction
 	tx, err := api.DB.Begin()
 	if err != nil {
-		return "", errors.Wrap(err, "Error creating database transaction")
+		return "", 0, errors.Wrap(err, "Error creating database transaction")
 	}
 
-	// Insert classifier type selector and retrieve its primary key so that we can
-	// use that to associate the classifier types
-	typeSelectorPK, classifierTypeSelectorID, err := api.insertClassifierTypeSelector(name, surveyPK, tx)
+	if err := api.checkIfMatch(tx, surveyID, ifMatch); err != nil {
+		tx.Rollback()
+		return "", 0, err
+	}
+
+	classifierTypeSelectorID, err := api.insertClassifier(tx, surveyPK, surveyID, classifier, actor)
 	if err != nil {
 		tx.Rollback()
-		return "", errors.Wrap(err, "Error fetching type selector primary key")
+		return "", 0, errors.Wrap(err, "Error inserting classifier")
 	}
 
-	// Insert classifier types
-	err = api.insertClassifierTypes(types, typeSelectorPK, tx)
+	version, err := api.bumpSurveyVersion(tx, surveyID)
 	if err != nil {
 		tx.Rollback()
-		return "", errors.Wrap(err, "Error inserting classifier types")
+		return "", 0, errors.Wrap(err, "Error updating survey version")
 	}
+
 	if err := tx.Commit(); err != nil {
 		tx.Rollback()
-		return "", errors.Wrap(err, "Error committing transaction for posting survey classifier")
+		return "", 0, errors.Wrap(err, "Error committing transaction for posting survey classifier")
 	}
 	logger.Info("Finished creating classifiers", zap.String("surveyID", surveyID))
-	return classifierTypeSelectorID.String(), nil
+	return classifierTypeSelectorID, version, nil
 }
 
 // PutSurveyDetails endpoint handler changes a survey short name using the survey reference
@@ -575,13 +1034,14 @@ func (api *API) PutSurveyDetails(w http.ResponseWriter, r *http.Request) {
 	err = json.Unmarshal(body, &putData)
 	if err != nil {
 		http.Error(w, "Error unmarshalling JSON", http.StatusBadRequest)
+		return
 	}
 
 	shortName := putData.ShortName
 	longName := putData.LongName
 	surveyMode := putData.SurveyMode
 
-	err = api.getSurveyRef(surveyRef)
+	found, err := api.getSurveyByReference(surveyRef)
 
 	if err == sql.ErrNoRows {
 		re := NewRESTError("404", "Survey not found")
@@ -603,13 +1063,70 @@ func (api *API) PutSurveyDetails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = api.PutSurveyDetailsBySurveyRefStmt.Exec(surveyRef, shortName, longName, surveyMode)
+	tx, err := api.DB.Begin()
+	if err != nil {
+		http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// Lock the survey and read it again inside the transaction, so its history records what was actually replaced
+	before, err := api.getSurveyForUpdate(tx, found.ID)
+	if err == sql.ErrNoRows || (err == nil && !strings.EqualFold(before.Reference, surveyRef)) {
+		rollBack(tx)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error retrieving survey by survey ref", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := api.checkIfMatch(tx, before.ID, r.Header.Get("If-Match")); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	after := *before
+	after.ShortName = shortName
+	after.LongName = longName
+	after.SurveyMode = surveyMode
+
+	actor := requestActor(r)
+	if reqErr := api.recordRename(tx, before.ID, actor, before, &after); reqErr != nil {
+		rollBack(tx)
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+
+	_, err = tx.Stmt(api.PutSurveyDetailsBySurveyRefStmt).Exec(surveyRef, shortName, longName, surveyMode)
 
 	if err != nil {
+		rollBack(tx)
 		http.Error(w, fmt.Sprintf("Update survey details query failed - %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	version, err := api.bumpSurveyVersion(tx, before.ID)
+	if err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to update survey version", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := api.writeAudit(tx, actor, before.ID, auditUpdateSurvey, before, after); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey update", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollBack(tx)
+		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", surveyETag(version))
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -623,66 +1140,51 @@ func (api *API) Info(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// AllSurveys returns a list of all known surveys
-func (api *API) AllSurveys(w http.ResponseWriter, r *http.Request) {
-	logger.Info("Getting AllSurveys", zap.String("url", r.URL.Path))
-	var rows *sql.Rows
-	var err error
-	rows, err = api.AllSurveysStmt.Query()
-	if err != nil {
-		logError("Get all surveys returned error", err)
-		http.Error(w, "Failed to retrieve surveys", http.StatusInternalServerError)
-		return
-	}
-	parseSurveys(rows, w)
-}
-
-// SurveysByType returns surveys of a particular type
+// SurveysByType returns surveys of a particular type, optionally filtered by status
 func (api *API) SurveysByType(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Getting SurveysByType", zap.String("url", r.URL.Path))
 	var rows *sql.Rows
 	var err error
-	var surveyMap = map[string]string{
-		"business": "Business",
-		"social":   "Social",
-		"census":   "Census",
-	}
 	vars := mux.Vars(r)
 	surveyType := strings.ToLower(vars["surveyType"])
 
-	if mappedSurveyType, ok := surveyMap[surveyType]; ok {
+	statuses, err := parseSurveyStatuses(r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if mappedSurveyType, ok := surveyTypes[surveyType]; ok {
 
-		rows, err = api.GetSurveysBySurveyTypeStmt.Query(mappedSurveyType)
+		rows, err = api.GetSurveysBySurveyTypeStmt.Query(mappedSurveyType, pq.Array(statuses))
 		if err != nil {
 			logError("Get surveys by type returned error", err)
 			http.Error(w, "Failed to retrieve surveys", http.StatusInternalServerError)
 			return
 		}
-		parseSurveys(rows, w)
+		api.parseSurveys(rows, w, r)
 		return
 	}
 	logError("Invalid surveyType in SurveysByType", fmt.Errorf("surveyType:%s", surveyType))
 	http.Error(w, "Failed to retrieve surveys", http.StatusBadRequest)
 }
 
-func parseSurveys(rows *sql.Rows, w http.ResponseWriter) {
-	var err error
-	defer rows.Close()
-	surveys := make([]*Survey, 0)
-
-	for rows.Next() {
-		survey := new(Survey)
-		err = rows.Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis)
-
-		if err != nil {
-			logError("Failed to get surveys from database", err)
-			http.Error(w, "Failed to get surveys from database", http.StatusInternalServerError)
-			return
-		}
+func (api *API) parseSurveys(rows *sql.Rows, w http.ResponseWriter, r *http.Request) {
+	surveys, err := scanSurveys(rows)
+	if err != nil {
+		logError("Failed to get surveys from database", err)
+		http.Error(w, "Failed to get surveys from database", http.StatusInternalServerError)
+		return
+	}
 
-		surveys = append(surveys, survey)
+	if _, ok := api.localiseSurveys(w, r, surveys...); !ok {
+		return
 	}
 
+	writeSurveys(w, surveys)
+}
+
+func writeSurveys(w http.ResponseWriter, surveys []*Survey) {
 	if len(surveys) == 0 {
 		logError("No surveys found", errors.New("no content"))
 		http.Error(w, "No surveys found", http.StatusNoContent)
@@ -742,14 +1244,24 @@ func (api *API) AllLegalBases(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-// GetSurvey returns the details of the survey identified by the string surveyID.
+// GetSurvey returns the details of the survey identified by the string surveyID, as it was at the time given by asOf
+// if there is one.
 func (api *API) GetSurvey(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Getting Survey", zap.String("url", r.URL.Path))
 	vars := mux.Vars(r)
 	id := vars["surveyId"]
-	survey := new(Survey)
-	surveyRow := api.GetSurveyStmt.QueryRow(id)
-	err := surveyRow.Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis)
+	asOf, err := parseAsOf(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var survey *Survey
+	if asOf != nil {
+		survey, err = api.getSurveyAsOf(id, *asOf)
+	} else {
+		survey, err = api.getSurvey(id)
+	}
 
 	if err == sql.ErrNoRows {
 		re := NewRESTError("404", "Survey not found")
@@ -771,6 +1283,15 @@ func (api *API) GetSurvey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	locale, ok := api.localiseSurveys(w, r, survey)
+	if !ok {
+		return
+	}
+
+	if writeNotModified(w, r, localisedSurveyETag(survey.Version, locale)) {
+		return
+	}
+
 	data, err := json.Marshal(survey)
 	if err != nil {
 		http.Error(w, "Failed to marshal survey JSON", http.StatusInternalServerError)
@@ -782,10 +1303,13 @@ func (api *API) GetSurvey(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// DeleteSurvey endpoint handler - archives the survey identified by surveyId, hiding it until it's restored. The
+// survey and its classifiers are only removed from the database when purge=true is given.
 func (api *API) DeleteSurvey(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	surveyID := vars["surveyId"]
-	logger.Info("Deleting survey", zap.String("surveyID", surveyID))
+	purge := r.URL.Query().Get("purge") == "true"
+	logger.Info("Deleting survey", zap.String("surveyID", surveyID), zap.Bool("purge", purge))
 
 	// Verify uuid is correct - return 400 if incorrect
 	if _, err := uuid.FromString(surveyID); err != nil {
@@ -800,28 +1324,70 @@ func (api *API) DeleteSurvey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete survey from survey table.  Cascading foreign keys take care of the deletion of the associated
-	// classifiertype and classifiertypeselector records
-	txDeleteSurveyByIDStmt := tx.Stmt(api.DeleteSurveyByIDStmt)
-	result, err := txDeleteSurveyByIDStmt.Exec(surveyID)
-	if err != nil {
-		http.Error(w, "Error executing delete statement", http.StatusInternalServerError)
+	// Lock the survey so it can't change between the version being checked against the delete preview and the
+	// delete, and keep what's about to be deleted, including the classifiers, for the audit trail
+	var before *Survey
+	var lockedVersion int
+	err = tx.Stmt(api.LockSurveyVersionStmt).QueryRow(surveyID).Scan(&lockedVersion)
+	if err == nil {
+		before, err = api.getSurveySnapshot(tx, surveyID)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		rollBack(tx)
+		logErrorAndRespond(w, "Error retrieving survey by survey ID", http.StatusInternalServerError, err)
 		return
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+
+	// An archived survey can still be purged but otherwise it's treated as if it's already gone
+	if err == sql.ErrNoRows || (before.ArchivedAt != nil && !purge) {
 		rollBack(tx)
-		re := NewRESTError("404", "Survey not found")
-		data, err := json.Marshal(re)
-		if err != nil {
-			http.Error(w, "Error marshaling NewRestError JSON", http.StatusInternalServerError)
+		writeRestErrorResponse(w, "Survey not found", http.StatusNotFound)
+		return
+	}
+
+	if err := api.checkIfMatch(tx, surveyID, r.Header.Get("If-Match")); err != nil {
+		rollBack(tx)
+		writePreconditionError(w, err)
+		return
+	}
+
+	// Archiving and purging both have to be confirmed with a token from the delete preview, so a populated survey
+	// can't be deleted by accident
+	if reqErr := api.useDeleteConfirmation(tx, r.URL.Query().Get(confirmationTokenParam), surveyID, before.Version); reqErr != nil {
+		rollBack(tx)
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+
+	operation := auditArchiveSurvey
+	var after interface{}
+	if purge {
+		// Delete survey from survey table.  Cascading foreign keys take care of the deletion of the associated
+		// classifiertype and classifiertypeselector records
+		operation = auditDeleteSurvey
+		if _, err := tx.Stmt(api.DeleteSurveyByIDStmt).Exec(surveyID); err != nil {
+			rollBack(tx)
+			http.Error(w, "Error executing delete statement", http.StatusInternalServerError)
 			return
 		}
+	} else {
+		archived := *before
+		if err := tx.Stmt(api.ArchiveSurveyStmt).QueryRow(surveyID).Scan(&archived.ArchivedAt); err != nil {
+			rollBack(tx)
+			logErrorAndRespond(w, "Error executing archive statement", http.StatusInternalServerError, err)
+			return
+		}
+		if _, err := api.bumpSurveyVersion(tx, surveyID); err != nil {
+			rollBack(tx)
+			logErrorAndRespond(w, "Failed to update survey version", http.StatusInternalServerError, err)
+			return
+		}
+		after = archived
+	}
 
-		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		w.WriteHeader(http.StatusNotFound)
-		w.Write(data)
-
+	if err := api.writeAudit(tx, requestActor(r), surveyID, operation, before, after); err != nil {
+		rollBack(tx)
+		logErrorAndRespond(w, "Failed to audit survey deletion", http.StatusInternalServerError, err)
 		return
 	}
 
@@ -830,7 +1396,7 @@ func (api *API) DeleteSurvey(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error committing transaction", http.StatusInternalServerError)
 		return
 	}
-	logger.Info("Successfully deleted survey", zap.String("surveyID", surveyID))
+	logger.Info("Successfully deleted survey", zap.String("surveyID", surveyID), zap.Bool("purge", purge))
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -844,7 +1410,14 @@ func (api *API) GetSurveyByShortName(w http.ResponseWriter, r *http.Request) {
 
 	survey := new(Survey)
 
-	err := surveyRow.Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis)
+	err := surveyRow.Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis, &survey.Version, &survey.Status, &survey.Periodicity, &survey.PeriodFormat, &survey.Attributes, pq.Array(&survey.Tags), ownerColumn{&survey.Owner})
+
+	// A short name the survey was previously known by finds the survey, with a link to where it is now
+	if err == sql.ErrNoRows {
+		if survey, err = api.getAliasedSurvey(aliasShortName, id); err == nil {
+			writeAliasLink(w, shortNameLocation(survey))
+		}
+	}
 
 	if err == sql.ErrNoRows {
 		re := NewRESTError("404", "Survey not found")
@@ -866,6 +1439,15 @@ func (api *API) GetSurveyByShortName(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "get survey by shortname query failed", http.StatusInternalServerError)
 		return
 	}
+
+	locale, ok := api.localiseSurveys(w, r, survey)
+	if !ok {
+		return
+	}
+
+	if writeNotModified(w, r, localisedSurveyETag(survey.Version, locale)) {
+		return
+	}
 	data, err := json.Marshal(survey)
 	if err != nil {
 		logError("Failed to marshal survey JSON", err)
@@ -879,15 +1461,31 @@ func (api *API) GetSurveyByShortName(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// GetSurveyByReference returns the details of the survey identified by the string ref.
+// GetSurveyByReference returns the details of the survey identified by the string ref, as it was at the time given by
+// asOf if there is one.
 func (api *API) GetSurveyByReference(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Getting SurveyByReference", zap.String("url", r.URL.Path))
 	vars := mux.Vars(r)
 	id := vars["ref"]
+	asOf, err := parseAsOf(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	surveyRow := api.GetSurveyByReferenceStmt.QueryRow(id)
-	survey := new(Survey)
-	err := surveyRow.Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis)
+	var survey *Survey
+	if asOf != nil {
+		survey, err = api.getSurveyByReferenceAsOf(id, *asOf)
+	} else {
+		survey, err = api.getSurveyByReference(id)
+
+		// A reference the survey was previously known by finds the survey, with a link to where it is now
+		if err == sql.ErrNoRows {
+			if survey, err = api.getAliasedSurvey(aliasRef, id); err == nil {
+				writeAliasLink(w, refLocation(survey))
+			}
+		}
+	}
 
 	if err == sql.ErrNoRows {
 		re := NewRESTError("404", "Survey not found")
@@ -908,6 +1506,15 @@ func (api *API) GetSurveyByReference(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	locale, ok := api.localiseSurveys(w, r, survey)
+	if !ok {
+		return
+	}
+
+	if writeNotModified(w, r, localisedSurveyETag(survey.Version, locale)) {
+		return
+	}
+
 	data, err := json.Marshal(survey)
 	if err != nil {
 		http.Error(w, "Failed to marshal survey JSON", http.StatusInternalServerError)
@@ -929,7 +1536,7 @@ func (api *API) AllClassifierTypeSelectors(w http.ResponseWriter, r *http.Reques
 	vars := mux.Vars(r)
 	surveyID := vars["surveyId"]
 
-	err := api.getSurveyID(surveyID)
+	version, err := api.getSurveyVersion(surveyID)
 
 	if err == sql.ErrNoRows {
 		re := NewRESTError("404", "Survey not found")
@@ -951,6 +1558,10 @@ func (api *API) AllClassifierTypeSelectors(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if writeNotModified(w, r, surveyETag(version)) {
+		return
+	}
+
 	// Now we can get the classifier type selector records.
 	rows, err := api.GetClassifierTypeSelectorStmt.Query(surveyID)
 
@@ -992,7 +1603,7 @@ func (api *API) AllClassifierTypeSelectors(w http.ResponseWriter, r *http.Reques
 }
 
 // GetClassifierTypeSelectorByID returns the details of the classifier type selector for the survey identified by the string surveyID and
-// the classifier type selector identified by the string classifierTypeSelectorID.
+// the classifier type selector identified by the string classifierTypeSelectorID, as they were at the time given by asOf if there is one.
 func (api *API) GetClassifierTypeSelectorByID(w http.ResponseWriter, r *http.Request) {
 	logger.Info("Getting ClassifierTypeSelectorByID", zap.String("url", r.URL.Path))
 	vars := mux.Vars(r)
@@ -1010,7 +1621,22 @@ func (api *API) GetClassifierTypeSelectorByID(w http.ResponseWriter, r *http.Req
 	surveyID := vars["surveyId"]
 	classifierTypeSelectorID := vars["classifierTypeSelectorId"]
 
-	err := api.getSurveyID(surveyID)
+	asOf, err := parseAsOf(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Classifier changes bump the survey's version too, so the survey's version as of the same time identifies the
+	// historical classifiers
+	var version int
+	if asOf != nil {
+		var survey *Survey
+		survey, err = api.getSurveyAsOf(surveyID, *asOf)
+		version = survey.Version
+	} else {
+		version, err = api.getSurveyVersion(surveyID)
+	}
 
 	if err == sql.ErrNoRows {
 		re := NewRESTError("404", "Classifier Type Selector not found")
@@ -1033,10 +1659,15 @@ func (api *API) GetClassifierTypeSelectorByID(w http.ResponseWriter, r *http.Req
 	}
 
 	// Now we can get the classifier type selector and classifier type records.
-	classifierRows, err := api.GetClassifierTypeSelectorByIDStmt.Query(classifierTypeSelectorID)
+	var classifierRows *sql.Rows
+	if asOf != nil {
+		classifierRows, err = api.GetClassifierTypeSelectorByIDAsOfStmt.Query(classifierTypeSelectorID, *asOf)
+	} else {
+		classifierRows, err = api.GetClassifierTypeSelectorByIDStmt.Query(classifierTypeSelectorID)
+	}
 	if err != nil {
 		http.Error(w, "Get classifiers query failed", http.StatusInternalServerError)
-
+		return
 	}
 	classifierTypeSelector := new(ClassifierTypeSelector)
 
@@ -1048,7 +1679,7 @@ func (api *API) GetClassifierTypeSelectorByID(w http.ResponseWriter, r *http.Req
 	for classifierRows.Next() {
 		err = classifierRows.Scan(&classifierTypeSelector.ID, &classifierTypeSelector.Name, &classifierType)
 		if err != nil {
-			fmt.Println(err)
+			logError("Get classifier type by id query failed", err)
 			http.Error(w, "Get classifier type by id query failed", http.StatusInternalServerError)
 			return
 		}
@@ -1072,6 +1703,10 @@ func (api *API) GetClassifierTypeSelectorByID(w http.ResponseWriter, r *http.Req
 	}
 	classifierTypeSelector.ClassifierTypes = classifierTypes
 
+	if writeNotModified(w, r, surveyETag(version)) {
+		return
+	}
+
 	data, err := json.Marshal(classifierTypeSelector)
 	if err != nil {
 		http.Error(w, "Failed to marshal classifier type JSON", http.StatusInternalServerError)
@@ -1084,9 +1719,51 @@ func (api *API) GetClassifierTypeSelectorByID(w http.ResponseWriter, r *http.Req
 
 }
 
-func (api *API) getSurveyID(surveyID string) error {
-	var id string
-	return api.GetSurveyIDStmt.QueryRow(surveyID).Scan(&id)
+// Get the version of the survey with the given UUID string
+func (api *API) getSurveyVersion(surveyID string) (int, error) {
+	var version int
+	err := api.GetSurveyVersionStmt.QueryRow(surveyID).Scan(&version)
+	return version, err
+}
+
+// Get the survey with the given UUID string
+func (api *API) getSurvey(surveyID string) (*Survey, error) {
+	survey := new(Survey)
+	err := api.GetSurveyStmt.QueryRow(surveyID).Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis, &survey.Version, &survey.Status, &survey.Periodicity, &survey.PeriodFormat, &survey.Attributes, pq.Array(&survey.Tags), ownerColumn{&survey.Owner})
+	return survey, err
+}
+
+// getSurveyForUpdate locks the survey with the given UUID string for the rest of transaction tx, so nothing else can
+// change it before the caller's write is committed, and returns it
+func (api *API) getSurveyForUpdate(tx *sql.Tx, surveyID string) (*Survey, error) {
+	var version int
+	if err := tx.Stmt(api.LockSurveyVersionStmt).QueryRow(surveyID).Scan(&version); err != nil {
+		return nil, err
+	}
+
+	return api.getSurveyInTx(tx, surveyID)
+}
+
+// getSurveyInTx returns the survey with the given UUID string, with its tags and owner, using transaction tx, so it
+// includes the transaction's own writes
+func (api *API) getSurveyInTx(tx *sql.Tx, surveyID string) (*Survey, error) {
+	survey := new(Survey)
+	err := tx.Stmt(api.GetSurveyStmt).QueryRow(surveyID).Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis, &survey.Version, &survey.Status, &survey.Periodicity, &survey.PeriodFormat, &survey.Attributes, pq.Array(&survey.Tags), ownerColumn{&survey.Owner})
+	return survey, err
+}
+
+// Get the survey with the given UUID string whether or not it has been archived
+func (api *API) getSurveyIncludingArchived(surveyID string) (*Survey, error) {
+	survey := new(Survey)
+	err := api.GetSurveyIncludingArchivedStmt.QueryRow(surveyID).Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis, &survey.ArchivedAt, &survey.Version, &survey.Status, &survey.Periodicity, &survey.PeriodFormat, &survey.Attributes)
+	return survey, err
+}
+
+// Get the survey with the given reference, ignoring case
+func (api *API) getSurveyByReference(surveyRef string) (*Survey, error) {
+	survey := new(Survey)
+	err := api.GetSurveyByReferenceStmt.QueryRow(surveyRef).Scan(&survey.ID, &survey.ShortName, &survey.LongName, &survey.Reference, &survey.LegalBasisRef, &survey.SurveyType, &survey.SurveyMode, &survey.LegalBasis, &survey.Version, &survey.Status, &survey.Periodicity, &survey.PeriodFormat, &survey.Attributes, pq.Array(&survey.Tags), ownerColumn{&survey.Owner})
+	return survey, err
 }
 
 func (api *API) getSurveyRef(surveyRef string) error {
@@ -1126,13 +1803,20 @@ func (api *API) getSurveyPKByID(surveyID string) (int, error) {
 
 }
 
+// Return a boolean true if a survey, archived or not, has the given UUID
+func (api *API) surveyIDExists(surveyID string) (bool, error) {
+	var exists bool
+	err := api.SurveyIDExistsStmt.QueryRow(surveyID).Scan(&exists)
+	return exists, err
+}
+
 func createStmt(sqlStatement string, db *sql.DB) (*sql.Stmt, error) {
 	return db.Prepare(sqlStatement)
 }
 
 // Close closes all db connections on the api struct
 func (api *API) Close() {
-	api.AllSurveysStmt.Close()
+	api.GetSurveysBySurveyTypeStmt.Close()
 }
 
 // Roll back a given transaction and log any errors which occur
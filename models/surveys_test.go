@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/ONSdigital/rm-survey-service/models"
@@ -52,8 +53,8 @@ func TestSurveyListReturnsJson(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", "test-surveytype", surveyMode, legalBasisLongName)
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", "test-surveytype", surveyMode, legalBasisLongName, nil, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
 
@@ -127,8 +128,8 @@ func TestSurveyListNotFound(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"})
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"})
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
 		// When
@@ -159,8 +160,8 @@ func TestSurveyListBySurveyTypeReturnsJson(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"}).AddRow("testid", shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName)
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.survey_type =").ExpectQuery().WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow("testid", shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName, nil, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.survey_type =").ExpectQuery().WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
 
@@ -199,8 +200,8 @@ func TestSurveyListBySurveyTypeIncorrectCaseReturnsJson(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName)
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.survey_type =").ExpectQuery().WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName, nil, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.survey_type =").ExpectQuery().WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
 
@@ -237,8 +238,8 @@ func TestSurveyListBySurveyModeEQ(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, "eQ", legalBasisLongName)
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.survey_type =").ExpectQuery().WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, "eQ", legalBasisLongName, nil, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.survey_type =").ExpectQuery().WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
 
@@ -274,8 +275,8 @@ func TestSurveyListBySurveyModeSEFT(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName)
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.survey_type =").ExpectQuery().WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName, nil, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.survey_type =").ExpectQuery().WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
 
@@ -313,7 +314,7 @@ func TestSurveyListBySurveyTypeReturnsErrorForUnknownType(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"}).AddRow("testid", shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow("testid", shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName, 1, "LIVE", nil, nil, nil, nil, nil)
 		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.surveyType =").ExpectQuery().WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -349,8 +350,8 @@ func TestSurveyGetReturnsJson(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName)
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName, 1, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
 
@@ -393,8 +394,8 @@ func TestSurveyGetNotFound(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"})
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"})
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
 
@@ -460,12 +461,61 @@ func TestSurveyGetInternalServerError(t *testing.T) {
 }
 
 func TestSurveyDeleteByIDSuccess(t *testing.T) {
-	Convey("Survey Delete by id returns an 204 on success", t, func() {
+	Convey("Survey Delete by id archives the survey and returns a 204", t, func() {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		mock.ExpectBegin()
 		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName, nil, 1, "LIVE", nil, nil, nil)
+		classifierRows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE")
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(classifierRows)
+		mock.ExpectPrepare("DELETE FROM survey.delete_confirmation WHERE token = .+").ExpectQuery().WithArgs(confirmationToken, surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("UPDATE survey.survey SET archived_at = now\\(\\) WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(time.Now()))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "ARCHIVE_SURVEY", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "?confirmationToken=" + confirmationToken
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("DELETE", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(r)
+		So(resp.StatusCode, ShouldEqual, http.StatusNoContent)
+	})
+}
+
+func TestSurveyDeletePurgeSuccess(t *testing.T) {
+	Convey("Survey Delete by id with purge removes the survey and returns a 204", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		mock.ExpectBegin()
+		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName, nil, 1, "LIVE", nil, nil, nil)
+		classifierRows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE")
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(classifierRows)
+		mock.ExpectPrepare("DELETE FROM survey.delete_confirmation WHERE token = .+").ExpectQuery().WithArgs(confirmationToken, surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
 		mock.ExpectPrepare("DELETE FROM survey.survey WHERE id = ?").ExpectExec().WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "DELETE_SURVEY", sqlmock.AnyArg(), nil).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		db.Begin()
 		defer db.Close()
@@ -481,7 +531,7 @@ func TestSurveyDeleteByIDSuccess(t *testing.T) {
 
 		ts := httptest.NewServer(router)
 		defer ts.Close()
-		url := ts.URL + "/surveys/" + surveyID
+		url := ts.URL + "/surveys/" + surveyID + "?purge=true&confirmationToken=" + confirmationToken
 		// User and password not set so base64encode the dividing character
 		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
 		r, err := http.NewRequest("DELETE", url, nil)
@@ -493,6 +543,44 @@ func TestSurveyDeleteByIDSuccess(t *testing.T) {
 	})
 }
 
+func TestSurveyDeleteArchivedNotFound(t *testing.T) {
+	Convey("Survey Delete by id returns a 404 if the survey is already archived", t, func() {
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		mock.ExpectBegin()
+		prepareMockStmts(mock)
+		surveyRows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "archived_at", "version", "status", "periodicity", "period_format", "attributes"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName, time.Now(), 1, "LIVE", nil, nil, nil)
+		classifierRows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(classifierID, "COLLECTION_INSTRUMENT", "FORM_TYPE")
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(surveyRows)
+		mock.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(classifierRows)
+		mock.ExpectRollback()
+		db.Begin()
+		defer db.Close()
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("DELETE", url, nil)
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(r)
+		So(resp.StatusCode, ShouldEqual, http.StatusNotFound)
+	})
+}
+
 func TestSurveyDeleteByIdInvalidUUID(t *testing.T) {
 	Convey("Survey Delete by id returns an 400 on invalid survey id", t, func() {
 		db, mock, err := sqlmock.New()
@@ -532,7 +620,7 @@ func TestSurveyDeleteByIdNotFound(t *testing.T) {
 		So(err, ShouldBeNil)
 		mock.ExpectBegin()
 		prepareMockStmts(mock)
-		mock.ExpectPrepare("DELETE FROM survey.survey WHERE id = ?").ExpectExec().WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}))
 		mock.ExpectRollback()
 		db.Begin()
 		defer db.Close()
@@ -568,8 +656,8 @@ func TestGetSurveyByShortnameReturnsJSON(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", "test-surveytype", surveyMode, legalBasisLongName)
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", "test-surveytype", surveyMode, legalBasisLongName, 1, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
 
@@ -612,8 +700,8 @@ func TestSurveyGetByShortNameNotFound(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"})
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"})
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
 
@@ -668,8 +756,8 @@ func TestGetSurveyByReferenceReturnsJSON(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName)
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, reference, "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName, 1, "LIVE", nil, nil, nil, nil, nil)
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
 
@@ -713,8 +801,9 @@ func TestSurveyGetByReferenceNotFound(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name"})
-		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"})
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref").ExpectQuery().WillReturnRows(rows)
+		mock.ExpectQuery("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").WithArgs("REF", reference).WillReturnRows(sqlmock.NewRows([]string{"survey_id"}))
 		db.Begin()
 		defer db.Close()
 		// When
@@ -766,9 +855,9 @@ func TestAllClassifierTypeSelectorsReturnsJSON(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		idRow := sqlmock.NewRows([]string{"id"}).AddRow("id").AddRow("id")
+		idRow := sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(1)
 		rows := sqlmock.NewRows([]string{"id", "classifiertypeselector"}).AddRow(surveyID, "test-name")
-		mock.ExpectPrepare("SELECT id FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
 		mock.ExpectPrepare("SELECT classifiertypeselector.id, classifier_type_selector FROM survey.classifiertypeselector INNER JOIN survey.survey ON classifiertypeselector.survey_fk = survey.survey_pk WHERE survey.id = .* ORDER BY classifier_type_selector ASC").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -808,9 +897,9 @@ func TestAllClassifierTypeSelectorsSurveyNotFound(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		idRow := sqlmock.NewRows([]string{"id"})
+		idRow := sqlmock.NewRows([]string{"version"})
 		rows := sqlmock.NewRows([]string{"id", "classifiertypeselector"}).AddRow(surveyID, "test-name")
-		mock.ExpectPrepare("SELECT id FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
 		mock.ExpectPrepare("SELECT classifiertypeselector.id, classifier_type_selector FROM survey.classifiertypeselector INNER JOIN survey.survey ON classifiertypeselector.survey_fk = survey.survey_pk WHERE survey.id = .* ORDER BY classifier_type_selector ASC").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -847,9 +936,9 @@ func TestAllClassifierTypeSelectorsNotFound(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		idRow := sqlmock.NewRows([]string{"id"}).AddRow("test-id")
+		idRow := sqlmock.NewRows([]string{"version"}).AddRow(1)
 		rows := sqlmock.NewRows([]string{"id", "classifiertypeselector"})
-		mock.ExpectPrepare("SELECT id FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
 		mock.ExpectPrepare("SELECT classifiertypeselector.id, classifier_type_selector FROM survey.classifiertypeselector INNER JOIN survey.survey ON classifiertypeselector.survey_fk = survey.survey_pk WHERE survey.id = .* ORDER BY classifier_type_selector ASC").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -884,7 +973,7 @@ func TestAllClassifierTypeSelectorsSurveyReturnsInternalServerError(t *testing.T
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
 		rows := sqlmock.NewRows([]string{"id", "classifier_type_selector"}).AddRow(surveyID, "test-name")
-		mock.ExpectPrepare("SELECT id FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnError(fmt.Errorf("Testing internal server error"))
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnError(fmt.Errorf("Testing internal server error"))
 		mock.ExpectPrepare("SELECT classifiertypeselector.id, classifier_type_selector FROM survey.classifiertypeselector INNER JOIN survey.survey ON classifiertypeselector.survey_fk = survey.surveypk WHERE survey.id = .* ORDER BY classifier_type_selector ASC").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -920,8 +1009,8 @@ func TestAllClassifierTypeSelectorsReturnsInternalServerError(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		idRow := sqlmock.NewRows([]string{"id"}).AddRow("id").AddRow("id")
-		mock.ExpectPrepare("SELECT id FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
+		idRow := sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(1)
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
 		mock.ExpectPrepare("SELECT classifiertypeselector.id, classifier_type_selector FROM survey.classifiertypeselector INNER JOIN survey.survey ON classifiertypeselector.survey_fk = survey.survey_pk WHERE survey.id = .* ").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnError(fmt.Errorf("Testing internal server error"))
 		db.Begin()
 		defer db.Close()
@@ -956,9 +1045,9 @@ func TestClassifierTypeSelectorByIdReturnsJSON(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		idRow := sqlmock.NewRows([]string{"id"}).AddRow("id").AddRow("id")
+		idRow := sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(1)
 		rows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(surveyID, "test-name", classifierID)
-		mock.ExpectPrepare("SELECT id FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
 		mock.ExpectPrepare("SELECT id, classifier_type_selector, classifier_type FROM survey.classifiertype INNER JOIN survey.classifiertypeselector ON classifiertype.classifier_type_selector_fk = classifiertypeselector.classifier_type_selector_pk WHERE classifiertypeselector.id = .* ORDER BY classifier_type ASC").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -999,9 +1088,9 @@ func TestClassifierTypeSelectorByIdSurveyIdIsInvalidUuid(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		idRow := sqlmock.NewRows([]string{"id"}).AddRow("id").AddRow("id")
+		idRow := sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(1)
 		rows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(surveyID, "test-name", classifierID)
-		mock.ExpectPrepare("SELECT id FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
 		mock.ExpectPrepare("SELECT id, classifier_type_selector, classifier_type FROM survey.classifiertype INNER JOIN survey.classifiertypeselector ON classifiertype.classifier_type_selector_fk = classifiertypeselector.classifier_type_selector_pk WHERE classifiertypeselector.id = .* ORDER BY classifier_type ASC").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -1037,9 +1126,9 @@ func TestClassifierTypeSelectorByIdClassifierIdIsInvalidUuid(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		idRow := sqlmock.NewRows([]string{"id"}).AddRow("id").AddRow("id")
+		idRow := sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(1)
 		rows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(surveyID, "test-name", classifierID)
-		mock.ExpectPrepare("SELECT id FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
 		mock.ExpectPrepare("SELECT id, classifier_type_selector, classifier_type FROM survey.classifiertype INNER JOIN survey.classifiertypeselector ON classifiertype.classifier_type_selector_fk = classifiertypeselector.classifier_type_selector_pk WHERE classifiertypeselector.id = .* ORDER BY classifier_type ASC").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -1075,9 +1164,9 @@ func TestClassifierTypeSelectorByIdReturns404(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		idRow := sqlmock.NewRows([]string{"id"})
+		idRow := sqlmock.NewRows([]string{"version"})
 		rows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(surveyID, "test-name", "test-type")
-		mock.ExpectPrepare("SELECT id FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
 		mock.ExpectPrepare("SELECT id, classifier_type_selector, classifier_type FROM survey.classifiertype INNER JOIN survey.classifiertypeselector ON classifiertype.classifier_type_selector_fk = classifiertypeselector.classifier_type_selector_pk WHERE classifiertypeselector.id = .* ORDER BY classifier_type ASC").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -1114,9 +1203,9 @@ func TestClassifierTypeSelectorByIdNoClassifierTypesReturns404(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		idRow := sqlmock.NewRows([]string{"id"}).AddRow(surveyID)
+		idRow := sqlmock.NewRows([]string{"version"}).AddRow(1)
 		rows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"})
-		mock.ExpectPrepare("SELECT id FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(idRow)
 		mock.ExpectPrepare("SELECT id, classifier_type_selector, classifier_type FROM survey.classifiertype INNER JOIN survey.classifiertypeselector ON classifiertype.classifier_type_selector_fk = classifiertypeselector.classifier_type_selector_pk WHERE classifiertypeselector.id = .* ORDER BY classifier_type ASC").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -1153,7 +1242,7 @@ func TestClassifierTypeSelectorByIdInternalServerError(t *testing.T) {
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
 		rows := sqlmock.NewRows([]string{"id", "classifier_type_selector", "classifier_type"}).AddRow(surveyID, "test-name", "test-type")
-		mock.ExpectPrepare("SELECT id FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnError(fmt.Errorf("Testing internal server error"))
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = ?").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnError(fmt.Errorf("Testing internal server error"))
 		mock.ExpectPrepare("SELECT id, classifier_type_selector, classifier_type FROM survey.classifiertype INNER JOIN survey.classifiertypeselector ON classifiertype.classifier_type_selector_fk = classifiertypeselector.classifier_type_selector_pk WHERE classifiertypeselector.id = .* ORDER BY classifier_type ASC").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -1188,10 +1277,18 @@ func TestPutSurveyDetailsBySurveyRefSuccess(t *testing.T) {
 	Convey("Survey Details PUT by Survey Reference success", t, func() {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
-		refRow := sqlmock.NewRows([]string{"survey_ref"}).AddRow("456")
+		surveyRow := sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, "456", "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName, 1, "LIVE", nil, nil, nil, nil, nil)
 		prepareMockStmts(mock)
-		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(refRow)
+		expectNoAliases(mock)
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref  WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(surveyRow)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectPrepare("SELECT id, s.short_name, .+ARRAY\\(SELECT .+\\) .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}).AddRow(surveyID, shortName, longName, "456", "test-legalbasis-ref", surveyType, surveyMode, legalBasisLongName, 1, "LIVE", nil, nil, nil, nil, nil))
 		mock.ExpectPrepare("UPDATE survey.survey SET short_name = .+, long_name = .+, survey_mode = .+ WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.survey_alias .+").ExpectExec().WithArgs(surveyID, "SHORT_NAME", shortName, "unknown").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "UPDATE_SURVEY", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
 		db.Begin()
 		defer db.Close()
 
@@ -1225,7 +1322,7 @@ func TestPutSurveyDetailsBySurveyRefInternalServerError(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		So(err, ShouldBeNil)
 		prepareMockStmts(mock)
-		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WillReturnError(fmt.Errorf("Testing internal server error"))
+		mock.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref  WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WillReturnError(fmt.Errorf("Testing internal server error"))
 		mock.ExpectPrepare("UPDATE survey.survey SET short_name = .+, long_name = .+ WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 		db.Begin()
 		defer db.Close()
@@ -1261,29 +1358,31 @@ func TestCreateNewSurvey(t *testing.T) {
 		So(err, ShouldBeNil)
 		rows := sqlmock.NewRows([]string{"survey_ref"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", "Statistics of Trade Act 1947")
-		newSurveyPK := sqlmock.NewRows([]string{"survey_pk"}).AddRow("1000")
+		newSurveyPK := sqlmock.NewRows([]string{"survey_pk", "version", "status"}).AddRow("1000", 1, "LIVE")
 
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
+
+		expectNoAttributeDefinitions(mock)
 
 		mock.ExpectRollback()
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs("99").WillReturnRows(rows)
-		mock.ExpectPrepare("INSERT INTO survey.survey \\( survey_pk, id, survey_ref, short_name, long_name, legal_basis, survey_type, survey_mode \\) VALUES \\( .+\\) RETURNING survey_pk").ExpectQuery().WithArgs(sqlmock.AnyArg(), "99", "test-short-name", "test-long-name", "STA1947", "Social", "SEFT").WillReturnRows(newSurveyPK)
+		mock.ExpectBegin()
+		mock.ExpectPrepare("INSERT INTO survey.survey \\( survey_pk, id, survey_ref, short_name, long_name, legal_basis, survey_type, survey_mode, periodicity, period_format, attributes \\) VALUES \\( .+\\) RETURNING survey_pk").ExpectQuery().WithArgs(sqlmock.AnyArg(), "99", "test-short-name", "test-long-name", "STA1947", "Social", "SEFT", nil, nil, "{}").WillReturnRows(newSurveyPK)
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(sqlmock.AnyArg(), "unknown", "CREATE_SURVEY", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE long_name = .+").ExpectQuery().WithArgs("Statistics of Trade Act 1947").WillReturnRows(legalBasis)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs("test-short-name").WillReturnRows(rows)
 
-		// Insert first classifier with one type
-		mock.ExpectBegin()
-		mock.ExpectPrepare("SELECT COUNT\\(classifiertypeselector.id\\) FROM survey.classifiertypeselector INNER JOIN survey.survey ON classifiertypeselector.survey_fk = survey.survey_pk WHERE survey.id = .+ AND classifiertypeselector.classifier_type_selector = .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"Count"}).AddRow(0))
+		// Insert first classifier with one type in the same transaction
 		mock.ExpectPrepare("INSERT INTO survey.classifiertypeselector .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1000"))
 		mock.ExpectPrepare("INSERT INTO survey.classifiertype .+").ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
-		mock.ExpectCommit()
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(sqlmock.AnyArg(), "unknown", "CREATE_CLASSIFIER", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 
 		// Insert second classifier with two types
-		mock.ExpectBegin()
-		mock.ExpectPrepare("SELECT COUNT\\(classifiertypeselector.id\\) FROM survey.classifiertypeselector INNER JOIN survey.survey ON classifiertypeselector.survey_fk = survey.survey_pk WHERE survey.id = .+ AND classifiertypeselector.classifier_type_selector = .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"Count"}).AddRow(0))
 		mock.ExpectPrepare("INSERT INTO survey.classifiertypeselector .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1000"))
 		mock.ExpectPrepare("INSERT INTO survey.classifiertype .+").ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectPrepare("INSERT INTO survey.classifiertype .+").ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(sqlmock.AnyArg(), "unknown", "CREATE_CLASSIFIER", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 
 		db.Begin()
@@ -1303,7 +1402,7 @@ func TestCreateNewSurvey(t *testing.T) {
 		url := ts.URL + "/surveys"
 		// User and password not set so base64encode the dividing character
 		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
-		var jsonStr = []byte(`{"ShortName": "test-short-name", "LongName":"test-long-name","SurveyRef":"99","LegalBasis":"Statistics of Trade Act 1947","SurveyType":"Social", "SurveyMode":"SEFT"}`)
+		var jsonStr = []byte(`{"ShortName": "test-short-name", "LongName":"test-long-name","SurveyRef":"99","LegalBasis":"Statistics of Trade Act 1947","SurveyType":"Social", "SurveyMode":"SEFT", "classifiers": [{"name": "COLLECTION_INSTRUMENT", "classifierTypes": ["FORM_TYPE"]}, {"name": "COMMUNICATION", "classifierTypes": ["RU_REF", "REGION"]}]}`)
 
 		r, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
 		r.Header.Set("Authorization", "Basic: "+basicAuth)
@@ -1312,6 +1411,12 @@ func TestCreateNewSurvey(t *testing.T) {
 		resp, err := httpClient.Do(r)
 
 		So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+		So(resp.Header.Get("ETag"), ShouldEqual, `"1"`)
+		res := models.Survey{}
+		body, err := io.ReadAll(resp.Body)
+		So(json.Unmarshal(body, &res), ShouldBeNil)
+		So(res.Classifiers, ShouldHaveLength, 2)
+		So(res.Classifiers[0].ID, ShouldNotBeEmpty)
 	})
 }
 
@@ -1322,8 +1427,9 @@ func TestCreateNewSurveyInvalidSurveyType(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"surveyref"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "longname"}).AddRow("STA1947", "Statistics of Trade Act 1947")
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
-		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legal_basis WHERE long_name = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
+		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE long_name = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		db.Begin()
 		defer db.Close()
@@ -1363,6 +1469,7 @@ func TestCreateNewSurveySurveyTypeDoesNotExist(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"surveyref"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "longname"}).AddRow("STA1947", "Statistics of Trade Act 1947")
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE long_name = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
@@ -1404,6 +1511,9 @@ func TestCreateNewSurveyNonExistentLegalBasisRef(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"surveyref"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "longname"})
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
 		db.Begin()
@@ -1443,6 +1553,9 @@ func TestCreateNewSurveyNonExistentLegalBasisLongName(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"surveyref"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "longname"})
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		mock.ExpectPrepare("INSERT INTO survey.survey \\( survey_pk, id, survey_ref, short_name, long_name, legal_basis \\) VALUES \\( .+\\)").ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE long_name = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
@@ -1484,6 +1597,9 @@ func TestCreateNewSurveyNonExistentSurveyModeName(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"surveyref"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "longname"})
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		mock.ExpectPrepare("INSERT INTO survey.survey \\( survey_pk, id, survey_ref, short_name, long_name, survey_mode, legal_basis \\) VALUES \\( .+\\)").ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE long_name = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
@@ -1525,6 +1641,9 @@ func TestCreateNewSurveyNonExistentLegalBasis(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"surveyref"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "longname"})
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
+		mock.ExpectQuery("SELECT survey_ref FROM survey.survey WHERE short_name = .+").WithArgs(sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"survey_ref"}))
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
 		db.Begin()
@@ -1612,6 +1731,8 @@ func TestCreateNewSurveyRefTooLong(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"surveyref"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "longname"}).AddRow("STA1947", "Statistics of Trade Act 1947")
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
@@ -1653,6 +1774,8 @@ func TestCreateNewSurveyShortNameWithSpace(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"surveyref"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "longname"}).AddRow("STA1947", "Statistics of Trade Act 1947")
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
@@ -1694,6 +1817,8 @@ func TestCreateNewSurveyShortNameTooLong(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"surveyref"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "longname"}).AddRow("STA1947", "Statistics of Trade Act 1947")
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
@@ -1734,6 +1859,8 @@ func TestCreateNewSurveyLongNameTooLong(t *testing.T) {
 		rows := sqlmock.NewRows([]string{"surveyref"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "longname"}).AddRow("STA1947", "Statistics of Trade Act 1947")
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
@@ -1775,6 +1902,8 @@ func TestCreateNewSurveyDupilcateSurveyRef(t *testing.T) {
 		shortNameRows := sqlmock.NewRows([]string{"short_name"})
 		legalBasis := sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", "Statistics of Trade Act 1947")
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(surveyRefRows)
 		mock.ExpectPrepare("INSERT INTO survey.survey \\( survey_pk, id, survey_ref, short_name, long_name, survey_type, legal_basis \\) VALUES \\( .+\\)").ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
@@ -1817,6 +1946,8 @@ func TestCreateNewSurveyDupilcateShortName(t *testing.T) {
 		noRows := sqlmock.NewRows([]string{"survey_ref"}).AddRow("0123")
 		legalBasis := sqlmock.NewRows([]string{"ref", "long_name"}).AddRow("STA1947", "Statistics of Trade Act 1947")
 		prepareMockStmts(mock)
+		expectNoAliases(mock)
+		expectNoAttributeDefinitions(mock)
 		mock.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(noRows)
 		mock.ExpectPrepare("INSERT INTO survey.survey \\( survey_pk, id, survey_ref, short_name, long_name, survey_type, legal_basis \\) VALUES \\( .+\\)").ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(legalBasis)
@@ -1866,6 +1997,8 @@ func TestCreateNewSurveyClassifiers(t *testing.T) {
 		mock.ExpectPrepare("INSERT INTO survey.classifiertype \\( classifier_type_pk, classifier_type_selector_fk, classifier_type \\) VALUES \\( .+, .+, .+ \\)").ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectPrepare("SELECT survey_pk FROM survey.survey WHERE id = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(surveyPKRows)
 		mock.ExpectPrepare("SELECT COUNT\\(classifiertypeselector.id\\) FROM survey.classifiertypeselector INNER JOIN survey.survey ON classifiertypeselector.survey_fk = survey.survey_pk WHERE survey.id = .+ AND classifiertypeselector.classifier_type_selector = .+").ExpectQuery().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(classifierTypeSelectorMatchesRow)
+		mock.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectPrepare("INSERT INTO survey.audit .+").ExpectExec().WithArgs(surveyID, "unknown", "CREATE_CLASSIFIER", nil, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 		var postData = []byte(`{"name": "test", "classifierTypes": ["TEST1"]}`)
 
@@ -2338,14 +2471,42 @@ func TestCreateNewSurveyClassifiers500Error(t *testing.T) {
 	})
 }
 
+// expectNoAttributeDefinitions expects surveys to be checked against the attribute definitions of a survey type which
+// has none
+func expectNoAttributeDefinitions(m sqlmock.Sqlmock) {
+	m.ExpectPrepare("SELECT survey_type, name, json_type, required, allowed_values FROM survey.attribute_definition .+").ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"survey_type", "name", "json_type", "required", "allowed_values"}))
+}
+
+// surveyForUpdateColumns are the columns of a survey read with its tags and owner
+var surveyForUpdateColumns = []string{"id", "short_name", "long_name", "survey_ref", "legal_basis", "survey_type", "survey_mode", "long_name", "version", "status", "periodicity", "period_format", "attributes", "tags", "owner"}
+
+// expectSurveyForUpdate expects the survey to be locked and read inside a transaction, returning rows
+func expectSurveyForUpdate(m sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	m.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE").ExpectQuery().WithArgs(surveyID).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	m.ExpectPrepare("SELECT id, s.short_name, .+ARRAY\\(SELECT .+\\) .+ WHERE id = .+").ExpectQuery().WithArgs(surveyID).WillReturnRows(rows)
+}
+
+// expectNoAliases expects the short name and reference of a survey being checked not to be aliases of any survey
+func expectNoAliases(m sqlmock.Sqlmock) {
+	for i := 0; i < 2; i++ {
+		m.ExpectPrepare("SELECT survey_id FROM survey.survey_alias WHERE kind = .+").ExpectQuery().
+			WillReturnRows(sqlmock.NewRows([]string{"survey_id"}))
+	}
+}
+
 func prepareMockStmts(m sqlmock.Sqlmock) {
 	m.ExpectBegin()
 	m.MatchExpectationsInOrder(false)
-	m.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref ORDER BY short_name ASC")
-	m.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = ?")
-	m.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref  WHERE LOWER\\(short_name\\) = LOWER\\(.+\\)")
-	m.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref  WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)")
-	m.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref")
+	m.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = ?")
+	m.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref  WHERE LOWER\\(short_name\\) = LOWER\\(.+\\)")
+	m.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.version, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref  WHERE LOWER\\(survey_ref\\) = LOWER\\(.+\\)")
+	m.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.status, s.periodicity, s.period_format, s.attributes, ARRAY\\(SELECT .+\\) FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE s.survey_type = .+")
+	m.ExpectPrepare("SELECT id, s.short_name, s.long_name, s.survey_ref, s.legal_basis, s.survey_type, s.survey_mode, lb.long_name, s.archived_at, s.version, s.status, s.periodicity, s.period_format, s.attributes FROM survey.survey s INNER JOIN survey.legalbasis lb on s.legal_basis = lb.ref WHERE id = .+")
+
+	m.ExpectPrepare("SELECT h.id, h.short_name, .+ FROM survey.survey_history h .+ WHERE h.id = .+")
+	m.ExpectPrepare("SELECT h.id, h.short_name, .+ FROM survey.survey_history h .+ WHERE LOWER\\(h.survey_ref\\) = LOWER\\(.+\\)")
+	m.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type FROM survey.classifiertype_history ct .+")
 
 	m.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE long_name = .+")
 	m.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis WHERE ref = .+")
@@ -2353,15 +2514,108 @@ func prepareMockStmts(m sqlmock.Sqlmock) {
 	m.ExpectPrepare("SELECT id, short_name, long_name, survey_ref, legal_basis, survey_type, survey_mode from survey.survey")
 	m.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE LOWER\\(survey_ref\\) = LOWER\\(.*\\)")
 	m.ExpectPrepare("UPDATE survey.survey SET short_name = .*, long_name = .* WHERE LOWER\\(survey_ref\\) = LOWER\\(.*\\)")
-	m.ExpectPrepare("SELECT id FROM survey.survey WHERE id = .*")
+	m.ExpectPrepare("UPDATE survey.survey SET survey_ref = .*, short_name = .*, long_name = .*, legal_basis = .*, survey_type = .*, survey_mode = .* WHERE id = .*")
+	m.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ AND archived_at IS NULL")
+	m.ExpectPrepare("SELECT version FROM survey.survey WHERE id = .+ FOR UPDATE")
+	m.ExpectPrepare("UPDATE survey.survey SET version = version \\+ 1 WHERE id = .+ RETURNING version")
 	m.ExpectPrepare("DELETE FROM survey.survey WHERE id = .*")
+	m.ExpectPrepare("UPDATE survey.survey SET archived_at = now\\(\\) WHERE id = .+ AND archived_at IS NULL RETURNING archived_at")
+	m.ExpectPrepare("UPDATE survey.survey SET archived_at = NULL WHERE id = .+")
+	m.ExpectPrepare("UPDATE survey.survey SET status = .+ WHERE id = .+")
 	m.ExpectPrepare("SELECT classifiertypeselector.id, classifier_type_selector FROM survey.classifiertypeselector INNER JOIN survey.survey ON classifiertypeselector.survey_fk = survey.survey_pk WHERE survey.id .*")
 	m.ExpectPrepare("SELECT id, classifier_type_selector, classifier_type FROM survey.classifiertype INNER JOIN survey.classifiertypeselector ON classifiertype.classifier_type_selector_fk = classifiertypeselector.classifier_type_selector_pk .*")
-	m.ExpectPrepare("INSERT INTO survey.survey \\( survey_pk, id, survey_ref, short_name, long_name, legal_basis, survey_type, survey_mode \\) VALUES \\( .+\\)")
+	m.ExpectPrepare("INSERT INTO survey.survey \\( survey_pk, id, survey_ref, short_name, long_name, legal_basis, survey_type, survey_mode, periodicity, period_format, attributes \\) VALUES \\( .+\\)")
 	m.ExpectPrepare("SELECT ref, long_name FROM survey.legalbasis")
 	m.ExpectPrepare("SELECT survey_ref FROM survey.survey WHERE short_name = .+")
 	m.ExpectPrepare("INSERT INTO survey.classifiertypeselector \\( classifier_type_selector_pk, id, survey_fk, classifier_type_selector \\) VALUES \\( .+\\) RETURNING classifier_type_selector_pk as id")
 	m.ExpectPrepare("INSERT INTO survey.classifiertype \\( classifier_type_pk, classifier_type_selector_fk, classifier_type \\) VALUES \\( .+\\)")
+	m.ExpectPrepare("DELETE FROM survey.classifiertypeselector WHERE survey_fk = .+")
+	m.ExpectPrepare("SELECT cts.id, cts.classifier_type_selector, ct.classifier_type FROM survey.classifiertypeselector cts .+")
+	m.ExpectPrepare("INSERT INTO survey.audit \\( survey_id, actor, operation, before_state, after_state \\) VALUES \\( .+ \\)")
+	m.ExpectPrepare("SELECT actor, occurred_at, operation, before_state, after_state FROM survey.audit WHERE survey_id = .+")
+	m.ExpectPrepare("INSERT INTO survey.scheduled_change \\( id, survey_id, changes, effective_from, created_by \\) VALUES \\( .+ \\) RETURNING state, created_at")
+	m.ExpectPrepare("SELECT id, survey_id, changes, effective_from, state, .+ FROM survey.scheduled_change WHERE survey_id = .+")
+	m.ExpectPrepare("UPDATE survey.scheduled_change SET state = 'CANCELLED', .+")
+	m.ExpectPrepare("SELECT id, survey_id, changes, created_by FROM survey.scheduled_change WHERE state = 'PENDING' AND effective_from <= now\\(\\) .+ FOR UPDATE SKIP LOCKED")
+	m.ExpectPrepare("UPDATE survey.scheduled_change SET state = .+, processed_at = now\\(\\), failure_reason = .+")
+	m.ExpectPrepare("INSERT INTO survey.idempotency_key \\( actor, idempotency_key, request_hash, expires_at \\) .+")
+	m.ExpectPrepare("SELECT request_hash, status_code, response_headers, response_body FROM survey.idempotency_key .+")
+	m.ExpectPrepare("UPDATE survey.idempotency_key SET status_code = .+")
+	m.ExpectPrepare("DELETE FROM survey.idempotency_key WHERE actor = .+")
+	m.ExpectPrepare("DELETE FROM survey.idempotency_key WHERE expires_at < now\\(\\)")
 	m.ExpectPrepare("SELECT survey_pk FROM survey.survey WHERE id = .+")
+	m.ExpectPrepare("SELECT EXISTS \\(SELECT 1 FROM survey.survey WHERE id = .+\\)")
+	m.ExpectPrepare("SELECT id FROM survey.classifiertypeselector WHERE id = ANY\\(.+\\)")
+	m.ExpectPrepare("UPDATE survey.survey SET short_name = .+, survey_ref = .+ WHERE id = .+")
+	m.ExpectPrepare("SELECT survey_id FROM survey.survey_alias WHERE kind = .+ AND LOWER\\(alias\\) = LOWER\\(.+\\)")
+	m.ExpectPrepare("SELECT kind, alias, created_by, created_at FROM survey.survey_alias WHERE survey_id = .+")
+	m.ExpectPrepare("INSERT INTO survey.survey_alias .+")
+	m.ExpectPrepare("DELETE FROM survey.survey_alias WHERE survey_id = .+")
+	m.ExpectPrepare("SELECT \\(SELECT COUNT\\(\\*\\) FROM survey.scheduled_change WHERE survey_id = .+\\), \\(SELECT COUNT\\(\\*\\) FROM survey.survey_alias WHERE survey_id = .+\\)")
+	m.ExpectPrepare("INSERT INTO survey.delete_confirmation .+")
+	m.ExpectPrepare("DELETE FROM survey.delete_confirmation WHERE token = .+ RETURNING version")
+	m.ExpectPrepare("DELETE FROM survey.delete_confirmation WHERE expires_at < now\\(\\)")
+	m.ExpectPrepare("UPDATE survey.classifiertypeselector SET survey_fk = .+ WHERE id = .+")
+	m.ExpectPrepare("DELETE FROM survey.classifiertypeselector WHERE id = .+")
+	m.ExpectPrepare("INSERT INTO survey.classifiertype \\(classifier_type_selector_fk, classifier_type\\) SELECT .+")
+	m.ExpectPrepare("UPDATE survey.survey_alias SET survey_id = .+ WHERE survey_id = .+")
+	m.ExpectPrepare("INSERT INTO survey.survey_tag .+")
+	m.ExpectPrepare("DELETE FROM survey.survey_tag WHERE survey_id = .+ AND tag = .+")
+	m.ExpectPrepare("SELECT t.tag, COUNT\\(\\*\\) FROM survey.survey_tag t .+")
+	m.ExpectPrepare("SELECT survey_type, name, json_type, required, allowed_values FROM survey.attribute_definition WHERE survey_type = .+")
+	m.ExpectPrepare("INSERT INTO survey.attribute_definition .+")
+	m.ExpectPrepare("DELETE FROM survey.attribute_definition WHERE survey_type = .+ AND name = .+")
+	m.ExpectPrepare("SELECT COUNT\\(\\*\\) FROM survey.survey WHERE survey_type = .+ AND attributes .+")
+	m.ExpectPrepare("SELECT COUNT\\(\\*\\) FROM survey.survey WHERE survey_type = .+ AND NOT attributes .+")
+	m.ExpectPrepare("SELECT division, team_mailbox, helpline, escalation_contacts FROM survey.survey_owner WHERE survey_id = .+")
+	m.ExpectPrepare("INSERT INTO survey.survey_owner .+")
+	m.ExpectPrepare("DELETE FROM survey.survey_owner WHERE survey_id = .+")
+	m.ExpectPrepare("SELECT id, s.short_name, .+ WHERE EXISTS \\(SELECT 1 FROM survey.survey_owner o .+")
+	m.ExpectPrepare("SELECT survey_id, locale, field, value FROM survey.survey_translation .+")
+	m.ExpectPrepare("INSERT INTO survey.survey_translation .+")
+	m.ExpectPrepare("DELETE FROM survey.survey_translation WHERE survey_id = .+")
+	m.ExpectPrepare("SELECT system, identifier FROM survey.survey_external_id WHERE survey_id = .+")
+	m.ExpectPrepare("INSERT INTO survey.survey_external_id .+")
+	m.ExpectPrepare("DELETE FROM survey.survey_external_id WHERE survey_id = .+")
+	m.ExpectPrepare("SELECT survey_id FROM survey.survey_external_id WHERE system = .+")
 	m.ExpectPrepare("SELECT COUNT\\(classifiertypeselector.id\\) FROM survey.classifiertypeselector INNER JOIN survey.survey ON classifiertypeselector.survey_fk = survey.survey_pk WHERE survey.id = .+ AND classifiertypeselector.classifier_type_selector = .+")
 }
+
+func TestCreateNewSurveyClassifiersUnicodeSpace(t *testing.T) {
+	Convey("Create new survey classifier rejects a name containing any kind of space", t, func() {
+
+		// Given
+		db, mock, err := sqlmock.New()
+		So(err, ShouldBeNil)
+		surveyPKRows := sqlmock.NewRows([]string{"survey_pk"}).AddRow("1000")
+		prepareMockStmts(mock)
+		mock.ExpectPrepare("SELECT survey_pk FROM survey.survey WHERE id = .+").ExpectQuery().WithArgs(sqlmock.AnyArg()).WillReturnRows(surveyPKRows)
+		var postData = []byte(`{"name": "COLLECTION INSTRUMENT", "classifierTypes": ["TEST"]}`)
+
+		// When
+		api, err := models.NewAPI(db)
+		So(err, ShouldBeNil)
+		defer api.Close()
+
+		// Create a new router and plug in the defined routes
+		router := mux.NewRouter()
+		models.SetUpRoutes(router, api)
+
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+		url := ts.URL + "/surveys/" + surveyID + "/classifiers"
+		// User and password not set so base64encode the dividing character
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(":"))
+		r, err := http.NewRequest("POST", url, bytes.NewBuffer(postData))
+		r.Header.Set("Authorization", "Basic: "+basicAuth)
+		r.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(r)
+		So(err, ShouldBeNil)
+
+		// Then
+		So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+		body, err := io.ReadAll(resp.Body)
+		So(string(body), ShouldStartWith, "Invalid request body - Classifier type selector name must not contain spaces")
+	})
+}